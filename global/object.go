@@ -1,5 +1,7 @@
 package global
 
+import "sync/atomic"
+
 const (
 	PublicCloud  int = iota // 共有云
 	PrivateCloud            // 私有云
@@ -10,8 +12,8 @@ const (
 	Interfacce_Type_S3                 // 通过S3上传模式
 )
 
-// 查询条件限制范围值
-var TargetValue int64
+// 查询条件限制范围值：按文件类型记录的扫描位置（上次获取到的最后一个 instance_key），只在获取数据时加锁访问
+var TargetValue map[FileType]int64
 
 // 文件类型
 type FileType int
@@ -21,14 +23,15 @@ const (
 	JPG                 // JPG 文件
 )
 
-// 文件状态
-type FileStatus int
-
-const (
-	FileNotExist FileStatus = iota // 文件不存在
-	FileExist                      // 文件存在
-	FileFailed                     // 文件失败
-)
+func (t FileType) String() string {
+	switch t {
+	case DCM:
+		return "dcm"
+	case JPG:
+		return "jpg"
+	}
+	return "unknown"
+}
 
 type ObjectData struct {
 	InstanceKey int64    // instance_key 目标key
@@ -47,7 +50,7 @@ type FileInfo struct {
 
 var (
 	ObjectDataChan chan ObjectData
-	RunStatus      bool // 当前获取的数据是否运行完成
+	RunStatus      atomic.Bool // 当前是否正在获取数据（定时任务和管理接口触发不能同时获取）
 )
 
 // 分段文件结果
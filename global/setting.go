@@ -6,9 +6,11 @@ import (
 )
 
 var (
-	ServerSetting   *setting.ServerSettingS
-	GeneralSetting  *setting.GeneralSettingS
-	DatabaseSetting *setting.DatabaseSettingS
-	ObjectSetting   *setting.ObjectSettingS
-	Logger          *logger.Logger
+	ServerSetting     *setting.ServerSettingS
+	GeneralSetting    *setting.GeneralSettingS
+	DatabaseSetting   *setting.DatabaseSettingS
+	ObjectSetting     *setting.ObjectSettingS
+	BandwidthSetting  *setting.BandwidthSettingS
+	SourceHostSetting *setting.SourceHostSettingS
+	Logger            *logger.Logger
 )
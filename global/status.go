@@ -0,0 +1,122 @@
+package global
+
+import (
+	"sync"
+	"time"
+)
+
+// 服务运行状态，供管理接口查询和控制
+type ServiceState struct {
+	mu           sync.RWMutex
+	paused       bool      // 定时任务是否暂停
+	lastCronRun  time.Time // 上次定时任务执行时间
+	batchStart   time.Time // 当前批次开始获取数据的时间
+	currentBatch int       // 当前批次放入任务队列的数量
+	discovering  bool      // 当前是否正在获取数据
+	stopping     bool      // 服务是否正在停止
+	trigger      chan struct{}
+}
+
+type StatusInfo struct {
+	Paused       bool      `json:"paused"`
+	LastCronRun  time.Time `json:"lastCronRun"`
+	BatchStart   time.Time `json:"batchStart"`
+	CurrentBatch int       `json:"currentBatch"`
+	Discovering  bool      `json:"discovering"`
+	Stopping     bool      `json:"stopping"`
+}
+
+var State = &ServiceState{
+	trigger: make(chan struct{}, 1),
+}
+
+// 暂停定时任务
+func (s *ServiceState) Pause() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = true
+}
+
+// 恢复定时任务
+func (s *ServiceState) Resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = false
+}
+
+func (s *ServiceState) Paused() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.paused
+}
+
+// 记录定时任务执行时间
+func (s *ServiceState) CronRun() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastCronRun = time.Now()
+}
+
+// 开始新一批数据获取
+func (s *ServiceState) BeginBatch() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batchStart = time.Now()
+	s.currentBatch = 0
+	s.discovering = true
+}
+
+// 当前批次放入任务队列的数量加一
+func (s *ServiceState) AddBatch() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.currentBatch++
+}
+
+// 当前批次数据获取完成
+func (s *ServiceState) EndBatch() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.discovering = false
+}
+
+func (s *ServiceState) Status() StatusInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return StatusInfo{
+		Paused:       s.paused,
+		LastCronRun:  s.lastCronRun,
+		BatchStart:   s.batchStart,
+		CurrentBatch: s.currentBatch,
+		Discovering:  s.discovering,
+		Stopping:     s.stopping,
+	}
+}
+
+// 请求立即执行一次数据获取，已有待执行的请求时返回false
+func (s *ServiceState) Trigger() bool {
+	select {
+	case s.trigger <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// 立即执行数据获取的请求通道
+func (s *ServiceState) Triggered() <-chan struct{} {
+	return s.trigger
+}
+
+// 开始停止服务，停止获取数据和接收新任务
+func (s *ServiceState) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopping = true
+}
+
+func (s *ServiceState) Stopping() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.stopping
+}
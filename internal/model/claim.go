@@ -0,0 +1,212 @@
+package model
+
+import (
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/global"
+	"context"
+	"database/sql"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 多实例认领上传数据
+// 获取数据时在同一事务中锁定数据、迁移为上传中并标记认领者（<prefix>_claim_owner）和租约到期时间（<prefix>_claim_expire），
+// 其他实例只获取未认领或租约已过期的数据；处理中的数据定时续租，实例异常退出后租约过期由其他实例重新认领
+
+// 续租时每条语句最多包含的数据条数
+const claimBatch = 500
+
+type claimKey struct {
+	key      int64
+	filetype global.FileType
+}
+
+// 本实例认领且未处理完成的数据
+var claims = struct {
+	sync.Mutex
+	m map[claimKey]struct{}
+}{m: make(map[claimKey]struct{})}
+
+// 认领者标识：ClaimOwner 为空时使用主机名，同一台服务器运行多个实例时需要分别配置
+func ClaimOwner() string {
+	if owner := global.GeneralSetting.ClaimOwner; owner != "" {
+		return owner
+	}
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return "unknown"
+	}
+	return host
+}
+
+// 租约时长
+func claimLease() time.Duration {
+	lease := time.Duration(global.GeneralSetting.ClaimLease) * time.Second
+	if lease <= 0 {
+		lease = 300 * time.Second
+	}
+	return lease
+}
+
+// file_remote 中按文件类型区分的字段前缀
+func claimPrefix(filetype global.FileType) string {
+	if filetype == global.JPG {
+		return "img"
+	}
+	return "dcm"
+}
+
+// 认领时同时更新的认领者和租约到期时间
+func claimSets(filetype global.FileType) (string, []interface{}) {
+	prefix := claimPrefix(filetype)
+	return `fr.` + prefix + `_claim_owner = ?,fr.` + prefix + `_claim_expire = date_add(now(), interval ? second)`,
+		[]interface{}{ClaimOwner(), int(claimLease().Seconds())}
+}
+
+// 生成 in 条件的占位符和参数
+func inClause(keys []int64) (string, []interface{}) {
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		args[i] = key
+	}
+	return strings.TrimSuffix(strings.Repeat("?,", len(keys)), ","), args
+}
+
+// 在同一事务中查询并认领数据，query 需要使用 for update 锁定查询结果
+func claimFileData(ctx context.Context, filetype global.FileType, query string, args ...interface{}) ([]int64, error) {
+	CheckWriteDB(ctx)
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	tx, err := global.WriteDBEngine.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var keys []int64
+	for rows.Next() {
+		var key sql.NullInt64
+		if err = rows.Scan(&key); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		keys = append(keys, key.Int64)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, tx.Commit()
+	}
+	// 查询结果已锁定，在同一事务中迁移为上传中
+	in, inArgs := inClause(keys)
+	sets, setArgs := claimSets(filetype)
+	n, err := transition(ctx, tx, filetype, StatusInProgress, sets, setArgs, `fr.instance_key in (`+in+`)`, inArgs...)
+	if err != nil {
+		return nil, err
+	}
+	if n < int64(len(keys)) {
+		global.Logger.Warn("部分", filetype, "数据不允许迁移为上传中, 查询: ", len(keys), " 认领: ", n)
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	claims.Lock()
+	for _, key := range keys {
+		claims.m[claimKey{key, filetype}] = struct{}{}
+	}
+	claims.Unlock()
+	return keys, nil
+}
+
+// 认领指定数据（管理接口手动上传使用），已结束的数据先重置为待上传，其他实例正在上传时返回false
+func ClaimInstance(ctx context.Context, key int64, filetype global.FileType) bool {
+	if status, ok := GetStatus(ctx, key, filetype); ok && status != StatusInProgress && CanTransition(status, StatusPending) {
+		Transition(ctx, key, filetype, StatusPending, "")
+	}
+	sets, args := claimSets(filetype)
+	if !Transition(ctx, key, filetype, StatusInProgress, sets, args...) {
+		return false
+	}
+	claims.Lock()
+	claims.m[claimKey{key, filetype}] = struct{}{}
+	claims.Unlock()
+	return true
+}
+
+// 释放本实例认领的所有数据（上传中 → 待上传），启动时释放上次运行遗留的认领，停止服务时释放未处理完成的数据供其他实例立即认领
+func ReleaseClaims(ctx context.Context) {
+	claims.Lock()
+	claims.m = make(map[claimKey]struct{})
+	claims.Unlock()
+	CheckWriteDB(ctx)
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	for _, filetype := range []global.FileType{global.DCM, global.JPG} {
+		where := `fr.` + claimPrefix(filetype) + `_claim_owner = ? and fr.` + statusColumn(filetype) + ` = ` + strconv.Itoa(int(StatusInProgress))
+		n, err := transition(ctx, global.WriteDBEngine, filetype, StatusPending, "", nil, where, ClaimOwner())
+		if err != nil {
+			global.Logger.Error("释放认领失败: ", err)
+			continue
+		}
+		if n > 0 {
+			global.Logger.Info("释放认领的", filetype, "数据: ", n, " 条")
+		}
+	}
+}
+
+// 为本实例认领且未处理完成的数据续租
+func renewClaims(ctx context.Context) {
+	claims.Lock()
+	keys := make(map[global.FileType][]int64)
+	for k := range claims.m {
+		keys[k.filetype] = append(keys[k.filetype], k.key)
+	}
+	claims.Unlock()
+	if len(keys) == 0 {
+		return
+	}
+	CheckWriteDB(ctx)
+	lease := int(claimLease().Seconds())
+	for filetype, list := range keys {
+		prefix := claimPrefix(filetype)
+		for len(list) > 0 {
+			n := len(list)
+			if n > claimBatch {
+				n = claimBatch
+			}
+			in, args := inClause(list[:n])
+			query := `update file_remote fr set fr.` + prefix + `_claim_expire = date_add(now(), interval ? second) where fr.` + prefix + `_claim_owner = ? and fr.instance_key in (` + in + `);`
+			qctx, cancel := queryContext(ctx)
+			result, err := global.WriteDBEngine.ExecContext(qctx, query, append([]interface{}{lease, ClaimOwner()}, args...)...)
+			cancel()
+			if err != nil {
+				global.Logger.Error("续租失败: ", err)
+			} else if affected, _ := result.RowsAffected(); affected < int64(n) {
+				// 租约已过期并被其他实例认领（或数据已处理完成），不影响本实例继续处理
+				global.Logger.Warn("部分", filetype, "数据续租失败，可能已被其他实例认领, 续租: ", n, " 成功: ", affected)
+			}
+			list = list[n:]
+		}
+	}
+}
+
+// 每隔租约时长的三分之一续租一次，ctx 取消后返回
+func RenewClaims(ctx context.Context) {
+	ticker := time.NewTicker(claimLease() / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			renewClaims(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package model
+
+import (
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/global"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// 按 instance_key 顺序分页获取数据
+// 每次从上次获取到的最后一个 instance_key（global.TargetValue）之后继续获取，获取不满一批时说明已到末尾，
+// 下次从 OBJECT_START_KEY 重新开始（回绕），已跳过的数据（被其他实例认领、稍后重置为待上传）在下一轮重新获取；
+// 扫描位置保存在 OBJECT_Cursor_File 中，重启后继续
+
+// 保存的扫描位置，排序方式或起始位置修改后不再沿用
+type scanCursor struct {
+	Order    string                    `json:"order"`
+	StartKey int64                     `json:"startKey"`
+	Keys     map[global.FileType]int64 `json:"keys"`
+}
+
+var cursorMu sync.Mutex
+var cursorLoaded bool
+
+// 是否按 instance_key 降序获取（优先上传最新的检查）
+func keyDescending() bool {
+	return strings.EqualFold(global.ObjectSetting.OBJECT_Key_Order, "desc")
+}
+
+func keyOrder() string {
+	if keyDescending() {
+		return "desc"
+	}
+	return "asc"
+}
+
+// 分页条件：升序获取大于扫描位置的数据，降序获取小于扫描位置的数据
+func keysetClause() string {
+	if keyDescending() {
+		return `and fr.instance_key < ?
+			order by fr.instance_key desc
+			limit ? for update;`
+	}
+	return `and fr.instance_key > ?
+			order by fr.instance_key asc
+			limit ? for update;`
+}
+
+// 一轮扫描的起点，包含 OBJECT_START_KEY 本身；降序且 OBJECT_START_KEY 为0时从最大的 instance_key 开始
+func startPosition() int64 {
+	start := global.ObjectSetting.OBJECT_START_KEY
+	if keyDescending() {
+		if start <= 0 {
+			return math.MaxInt64
+		}
+		return start + 1
+	}
+	return start - 1
+}
+
+func cursorFile() string {
+	if path := global.ObjectSetting.OBJECT_Cursor_File; path != "" {
+		return path
+	}
+	return filepath.Join("storage", "cursor.json")
+}
+
+// 读取保存的扫描位置，调用时需持有锁
+func loadCursor() {
+	cursorLoaded = true
+	global.TargetValue = map[global.FileType]int64{
+		global.DCM: startPosition(),
+		global.JPG: startPosition(),
+	}
+	content, err := os.ReadFile(cursorFile())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			global.Logger.Error("读取扫描位置失败: ", err)
+		}
+		return
+	}
+	c := scanCursor{}
+	if err = json.Unmarshal(content, &c); err != nil {
+		global.Logger.Error("解析扫描位置失败: ", err)
+		return
+	}
+	if c.Order != keyOrder() || c.StartKey != global.ObjectSetting.OBJECT_START_KEY {
+		global.Logger.Info("排序方式或起始位置已修改，从 OBJECT_START_KEY 重新开始获取数据")
+		return
+	}
+	for filetype, key := range c.Keys {
+		global.TargetValue[filetype] = key
+	}
+	global.Logger.Info("继续上次的扫描位置: ", global.TargetValue)
+}
+
+// 写入临时文件后重命名，避免进程中断时留下不完整的记录，调用时需持有锁
+func saveCursor() error {
+	path := cursorFile()
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	content, err := json.Marshal(scanCursor{
+		Order:    keyOrder(),
+		StartKey: global.ObjectSetting.OBJECT_START_KEY,
+		Keys:     global.TargetValue,
+	})
+	if err != nil {
+		return err
+	}
+	temp := path + ".tmp"
+	if err = os.WriteFile(temp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(temp, path)
+}
+
+// 当前扫描位置
+func scanPosition(filetype global.FileType) int64 {
+	cursorMu.Lock()
+	defer cursorMu.Unlock()
+	if !cursorLoaded {
+		loadCursor()
+	}
+	return global.TargetValue[filetype]
+}
+
+// 按本次获取的数据移动扫描位置，keys 按获取顺序排列；获取不满 limit 条时回到起点
+func advanceCursor(filetype global.FileType, keys []int64, limit int) {
+	cursorMu.Lock()
+	defer cursorMu.Unlock()
+	if len(keys) < limit {
+		if global.TargetValue[filetype] != startPosition() {
+			global.Logger.Info(filetype, " 数据已获取到末尾，下次从起始位置重新获取")
+		}
+		global.TargetValue[filetype] = startPosition()
+	} else {
+		global.TargetValue[filetype] = keys[len(keys)-1]
+	}
+	if err := saveCursor(); err != nil {
+		global.Logger.Error("保存扫描位置失败: ", err)
+	}
+}
@@ -0,0 +1,80 @@
+package model
+
+import (
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/global"
+	"context"
+	"database/sql"
+)
+
+// 错误信息最大长度（file_remote_failure.last_error_msg）
+const maxFailureMsg = 1024
+
+// 上传失败记录（file_remote_failure），日志过期后仍可查询失败原因
+type UploadFailure struct {
+	InstanceKey     int64           `json:"instanceKey"`
+	Type            global.FileType `json:"type"`
+	AttemptCount    int             `json:"attemptCount"`
+	RetryCount      int             `json:"retryCount"`
+	LastErrorCode   string          `json:"lastErrorCode"`
+	LastErrorMsg    string          `json:"lastErrorMsg"`
+	LastAttemptTime string          `json:"lastAttemptTime"`
+	Backend         string          `json:"backend"`
+}
+
+// 记录一次上传失败：失败次数加一，保存最后一次失败的错误码、错误信息、时间和存储后端
+func RecordFailure(ctx context.Context, key int64, filetype global.FileType, backend, code, msg string) {
+	if r := []rune(msg); len(r) > maxFailureMsg {
+		msg = string(r[:maxFailureMsg])
+	}
+	if r := []rune(code); len(r) > 64 {
+		code = string(r[:64])
+	}
+	query := `insert into file_remote_failure (instance_key,file_type,store_type,attempt_count,last_error_code,last_error_msg,last_attempt_time,backend)
+	values (?,?,?,1,?,?,now(),?)
+	on duplicate key update attempt_count = attempt_count + 1,last_error_code = values(last_error_code),last_error_msg = values(last_error_msg),
+	last_attempt_time = values(last_attempt_time),backend = values(backend);`
+	CheckWriteDB(ctx)
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	_, err := global.WriteDBEngine.ExecContext(ctx, query, key, filetype, global.ObjectSetting.OBJECT_Store_Type, code, msg, backend)
+	if err != nil {
+		global.Logger.Error("保存上传失败记录失败: ", key, " err: ", err)
+	}
+}
+
+// 上传成功后删除失败记录
+func clearFailure(ctx context.Context, key int64, filetype global.FileType) {
+	query := `delete from file_remote_failure where instance_key = ? and file_type = ? and store_type = ?;`
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	_, err := global.WriteDBEngine.ExecContext(ctx, query, key, filetype, global.ObjectSetting.OBJECT_Store_Type)
+	if err != nil {
+		global.Logger.Error("删除上传失败记录失败: ", key, " err: ", err)
+	}
+}
+
+// 查询上传失败记录，没有失败记录时返回false
+func GetFailure(ctx context.Context, key int64, filetype global.FileType) (UploadFailure, bool) {
+	query := `select attempt_count,retry_count,last_error_code,last_error_msg,date_format(last_attempt_time,'%Y-%m-%d %H:%i:%s'),backend from file_remote_failure
+	where instance_key = ? and file_type = ? and store_type = ?;`
+	if !CheckReadDB(ctx) {
+		return UploadFailure{}, false
+	}
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	var code, msg, attempt, backend sql.NullString
+	failure := UploadFailure{InstanceKey: key, Type: filetype}
+	err := global.ReadDBEngine.QueryRowContext(ctx, query, key, filetype, global.ObjectSetting.OBJECT_Store_Type).
+		Scan(&failure.AttemptCount, &failure.RetryCount, &code, &msg, &attempt, &backend)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			global.Logger.Error("查询上传失败记录失败: ", key, " err: ", err)
+		}
+		return UploadFailure{}, false
+	}
+	failure.LastErrorCode = code.String
+	failure.LastErrorMsg = msg.String
+	failure.LastAttemptTime = attempt.String
+	failure.Backend = backend.String
+	return failure, true
+}
@@ -1,7 +1,10 @@
 package model
 
 import (
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/global"
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/metrics"
 	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/setting"
+	"context"
 	"database/sql"
 	"time"
 
@@ -29,3 +32,43 @@ func NewDBEngine(databaseSetting *setting.DatabaseSettingS) (*sql.DB, error) {
 
 	return db, nil
 }
+
+// 单次查询/更新的 context，超时时间为 QueryTimeout
+func queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := time.Duration(global.DatabaseSetting.QueryTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// 检查读库连接，返回连接是否有效
+// 无效的连接由 database/sql 连接池丢弃并在下次使用时重新建立，不关闭和替换 *sql.DB（其他goroutine可能正在使用）
+func CheckReadDB(ctx context.Context) bool {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	err := global.ReadDBEngine.PingContext(ctx)
+	metrics.ObserveDBStats("read", global.ReadDBEngine.Stats())
+	if err == nil {
+		metrics.DBPing.WithLabelValues("read", metrics.ResultSuccess).Inc()
+		return true
+	}
+	metrics.DBPing.WithLabelValues("read", metrics.ResultFailed).Inc()
+	global.Logger.Error("ReadDBEngine.ping() err: ", err)
+	return false
+}
+
+// 检查写库连接，返回连接是否有效
+func CheckWriteDB(ctx context.Context) bool {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	err := global.WriteDBEngine.PingContext(ctx)
+	metrics.ObserveDBStats("write", global.WriteDBEngine.Stats())
+	if err == nil {
+		metrics.DBPing.WithLabelValues("write", metrics.ResultSuccess).Inc()
+		return true
+	}
+	metrics.DBPing.WithLabelValues("write", metrics.ResultFailed).Inc()
+	global.Logger.Error("WriteDBEngine.ping() err: ", err)
+	return false
+}
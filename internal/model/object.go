@@ -3,142 +3,210 @@ package model
 import (
 	"WowjoyProject/ObjectCloudService_Upload_Dicom/global"
 	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/general"
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/metrics"
+	"context"
+	"database/sql"
 )
 
 // 自动上传公有云数据
-func GetUploadPublicData() {
-	if global.RunStatus {
+func GetUploadPublicData(ctx context.Context) {
+	if !global.RunStatus.CompareAndSwap(false, true) {
 		global.Logger.Info("上次获取的数据没有消耗完，等待消耗完，再获取数据....")
 		return
 	}
-	global.RunStatus = true
+	defer global.RunStatus.Store(false)
 	global.Logger.Info("******自动上传公有云数据******")
-	GetData()
-	global.RunStatus = false
+	GetData(ctx)
 }
 
 // 自动上传私有云数据
-func GetUploadPrivateData() {
-	if global.RunStatus {
+func GetUploadPrivateData(ctx context.Context) {
+	if !global.RunStatus.CompareAndSwap(false, true) {
 		global.Logger.Info("上次获取的数据没有消耗完，等待消耗完，再获取数据....")
 		return
 	}
+	defer global.RunStatus.Store(false)
 	global.Logger.Info("******自动上传私有云数据******")
-	global.RunStatus = true
-	GetData()
-	global.RunStatus = false
+	GetData(ctx)
 }
 
-func GetData() {
+// 获取需要上传的数据：DCM文件，开启JPG上传时再获取JPG文件
+// ctx 取消（停止服务）时停止获取数据
+func GetData(ctx context.Context) {
+	global.State.BeginBatch()
+	defer global.State.EndBatch()
+	GetFileData(ctx, global.DCM)
+	if global.ObjectSetting.JPG_Upload_Enable && ctx.Err() == nil {
+		GetFileData(ctx, global.JPG)
+	}
+}
+
+// 按文件类型从 file_remote 认领需要上传的数据并放入任务队列
+// 按 instance_key 分页获取（OBJECT_Key_Order），只获取未被认领或租约已过期的数据，多个实例同时运行时同一条数据只由一个实例上传
+func GetFileData(ctx context.Context, filetype global.FileType) {
 	sql := ""
-	switch global.ObjectSetting.OBJECT_Store_Type {
-	case global.PublicCloud:
-		sql = `select fr.instance_key,fr.dcm_file_name_remote from file_remote fr 
-		where 1= 1
-		and fr.dcm_file_exist = 1
-		and fr.dcm_file_exist_obs_cloud = 0
-		and timestampdiff(YEAR,fr.dcm_update_time_retrieve,now()) <= ?
-		limit ?;`
-	case global.PrivateCloud:
-		sql = `select fr.instance_key,fr.dcm_file_name_remote from file_remote fr 
-		where 1= 1
-		and fr.dcm_file_exist = 1
-		and fr.dcm_file_exist_obs_local = 0
-		and timestampdiff(YEAR,fr.dcm_update_time_retrieve,now()) <= ?
-		limit ?;`
-	}
-	err := global.ReadDBEngine.Ping()
-	if err != nil {
-		global.Logger.Error("ReadDBEngine.ping() err: ", err)
-		global.ReadDBEngine.Close()
-		global.ReadDBEngine, _ = NewDBEngine(global.DatabaseSetting)
+	limit := global.GeneralSetting.MaxTasks
+	switch filetype {
+	case global.DCM:
+		switch global.ObjectSetting.OBJECT_Store_Type {
+		case global.PublicCloud:
+			sql = `select fr.instance_key from file_remote fr 
+			where 1= 1
+			and fr.dcm_file_exist = 1
+			and fr.dcm_file_exist_obs_cloud in (` + fromStatus(StatusInProgress) + `)
+			and timestampdiff(YEAR,fr.dcm_update_time_retrieve,now()) <= ?
+			and (fr.dcm_claim_expire is null or fr.dcm_claim_expire < now())
+			` + keysetClause()
+		case global.PrivateCloud:
+			sql = `select fr.instance_key from file_remote fr 
+			where 1= 1
+			and fr.dcm_file_exist = 1
+			and fr.dcm_file_exist_obs_local in (` + fromStatus(StatusInProgress) + `)
+			and timestampdiff(YEAR,fr.dcm_update_time_retrieve,now()) <= ?
+			and (fr.dcm_claim_expire is null or fr.dcm_claim_expire < now())
+			` + keysetClause()
+		}
+	case global.JPG:
+		limit = global.ObjectSetting.JPG_MaxTasks
+		switch global.ObjectSetting.OBJECT_Store_Type {
+		case global.PublicCloud:
+			sql = `select fr.instance_key from file_remote fr 
+			where 1= 1
+			and fr.img_file_exist = 1
+			and fr.img_file_exist_obs_cloud in (` + fromStatus(StatusInProgress) + `)
+			and timestampdiff(YEAR,fr.img_update_time_retrieve,now()) <= ?
+			and (fr.img_claim_expire is null or fr.img_claim_expire < now())
+			` + keysetClause()
+		case global.PrivateCloud:
+			sql = `select fr.instance_key from file_remote fr 
+			where 1= 1
+			and fr.img_file_exist = 1
+			and fr.img_file_exist_obs_local in (` + fromStatus(StatusInProgress) + `)
+			and timestampdiff(YEAR,fr.img_update_time_retrieve,now()) <= ?
+			and (fr.img_claim_expire is null or fr.img_claim_expire < now())
+			` + keysetClause()
+		}
 	}
-	rows, err := global.ReadDBEngine.Query(sql, global.ObjectSetting.OBJECT_TIME, global.GeneralSetting.MaxTasks)
+	if limit <= 0 {
+		limit = global.GeneralSetting.MaxTasks
+	}
+	var count int
+	defer func() {
+		metrics.DiscoveryRuns.WithLabelValues(filetype.String()).Inc()
+		metrics.DiscoveryBatchSize.WithLabelValues(filetype.String()).Observe(float64(count))
+	}()
+	// 认领在写库执行，认领的数据在处理期间定时续租，放入任务队列等待空闲worker的时间不影响租约
+	// 按 instance_key 顺序从上次的扫描位置继续获取，避免每次都重复获取前面失败的数据
+	position := scanPosition(filetype)
+	keys, err := claimFileData(ctx, filetype, sql, global.ObjectSetting.OBJECT_TIME, position, limit)
 	if err != nil {
-		global.Logger.Error(err)
+		global.Logger.Error("认领上传数据失败: ", err)
 		return
 	}
-	defer rows.Close()
-	for rows.Next() {
-		key := KeyData{}
-		err = rows.Scan(&key.InstanceKey, &key.RemoetKey)
-		if err != nil {
-			global.Logger.Error("rows.Scan error: ", err)
-			continue
-		}
+	advanceCursor(filetype, keys, limit)
+	global.Logger.Info("认领", filetype, "数据: ", len(keys), " 条, 认领者: ", ClaimOwner())
+	for _, key := range keys {
 		// 获取文件路径
-		info := GetFileInfo(key.InstanceKey.Int64)
+		info := GetFileInfo(ctx, key, filetype)
+		if ctx.Err() != nil {
+			break
+		}
 		if info.FileName == "" {
-			// 异常数据不需要处理，更新为错误数据
-			UpdateLocalStatus(key.InstanceKey.Int64)
+			// 异常数据不需要处理，更新为跳过
+			updateInvalidStatus(ctx, key, filetype, StatusSkippedInvalid)
 			continue
 		}
 		// 判断数据是否是上传数据
-		var dataFlag bool
-		switch global.ObjectSetting.UploadImgFlag {
-		case "001":
-			if info.Modality != "US" && info.Modality != "ES" {
-				dataFlag = true
-			}
-		case "010":
-			if info.Modality == "US" {
-				dataFlag = true
-			}
-		case "011":
-			if info.Modality != "ES" {
-				dataFlag = true
-			}
-		case "100":
-			if info.Modality == "ES" {
-				dataFlag = true
-			}
-		case "101":
-			if info.Modality != "US" {
-				dataFlag = true
-			}
-		case "110":
-			if info.Modality == "US" && info.Modality == "ES" {
-				dataFlag = true
-			}
-		case "111":
-			dataFlag = true
-		default:
-			dataFlag = true
-		}
-		if !dataFlag {
-			global.Logger.Info("数据上传设置为：", global.ObjectSetting.UploadImgFlag, "该数据不需要上传处理,更新文件状态为4,数据key: ", key.InstanceKey.Int64)
-			UpdateLocalStatus(key.InstanceKey.Int64)
+		if !NeedUpload(info.Modality) {
+			global.Logger.Info("数据上传设置为：", global.ObjectSetting.UploadImgFlag, "该数据不需要上传处理,更新文件状态为", StatusSkippedModality, ",数据key: ", key)
+			updateInvalidStatus(ctx, key, filetype, StatusSkippedModality)
 			continue
 		}
-		filekey, filepath := general.GetFilePath(info.FileName, info.Ip, info.SVirtualDir)
-
-		data := global.ObjectData{
-			InstanceKey: key.InstanceKey.Int64,
-			FileKey:     filekey,
-			FilePath:    filepath,
-			Type:        global.DCM,
-			Count:       1,
+		select {
+		case global.ObjectDataChan <- NewObjectData(key, filetype, info):
+		case <-ctx.Done():
 		}
-		global.ObjectDataChan <- data
+		if ctx.Err() != nil {
+			break
+		}
+		global.State.AddBatch()
+		count++
+	}
+	if ctx.Err() != nil {
+		// 未放入任务队列的数据在停止服务时统一释放认领
+		global.Logger.Info("服务正在停止，停止获取数据")
+	}
+}
+
+// 生成上传任务
+func NewObjectData(instancekey int64, filetype global.FileType, info global.FileInfo) global.ObjectData {
+	filekey, filepath := general.GetFilePath(info.FileName, info.Ip, info.SVirtualDir)
+	return global.ObjectData{
+		InstanceKey: instancekey,
+		FileKey:     filekey,
+		FilePath:    filepath,
+		Type:        filetype,
+		Count:       1,
+	}
+}
+
+// 按 instance_key 生成上传任务（管理接口手动上传使用），不做检查类型过滤
+func GetInstanceData(ctx context.Context, instancekey int64, filetype global.FileType) (global.ObjectData, bool) {
+	info := GetFileInfo(ctx, instancekey, filetype)
+	if info.FileName == "" {
+		return global.ObjectData{}, false
+	}
+	return NewObjectData(instancekey, filetype, info), true
+}
+
+// 根据 UploadImgFlag 判断该检查类型的数据是否需要上传
+// (从左到右，第一位表示内镜，第二位表示超声，第三位表示放射)
+func NeedUpload(modality string) bool {
+	switch global.ObjectSetting.UploadImgFlag {
+	case "001":
+		return modality != "US" && modality != "ES"
+	case "010":
+		return modality == "US"
+	case "011":
+		return modality != "ES"
+	case "100":
+		return modality == "ES"
+	case "101":
+		return modality != "US"
+	case "110":
+		// 保持原有判断（modality == "US" && modality == "ES"，不会同时成立），该配置下不上传
+		return false
 	}
+	return true
 }
 
-func GetFileInfo(instancekey int64) (info global.FileInfo) {
+// 更新不需要上传的数据状态
+func updateInvalidStatus(ctx context.Context, key int64, filetype global.FileType, status UploadStatus) {
+	Transition(ctx, key, filetype, status, "")
+}
+
+// 获取文件信息，DCM文件取 instance.file_name，JPG文件取 instance.img_file_name
+func GetFileInfo(ctx context.Context, instancekey int64, filetype global.FileType) (info global.FileInfo) {
 	sql := `select ins.file_name,s.modality,sl.ip,sl.s_virtual_dir 
 	from instance ins 
 	left join study s on ins.study_key = s.study_key 
 	left join study_location sl on sl.n_station_code = ins.location_code 
 	where ins.instance_key = ?;`
-	err := global.ReadDBEngine.Ping()
-	if err != nil {
-		global.Logger.Error("ReadDBEngine.ping() err: ", err)
-		global.ReadDBEngine.Close()
-		global.ReadDBEngine, _ = NewDBEngine(global.DatabaseSetting)
+	if filetype == global.JPG {
+		sql = `select ins.img_file_name,s.modality,sl.ip,sl.s_virtual_dir 
+		from instance ins 
+		left join study s on ins.study_key = s.study_key 
+		left join study_location sl on sl.n_station_code = ins.location_code 
+		where ins.instance_key = ?;`
+	}
+	if !CheckReadDB(ctx) {
 		return
 	}
-	row := global.ReadDBEngine.QueryRow(sql, instancekey)
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	row := global.ReadDBEngine.QueryRowContext(ctx, sql, instancekey)
 	key := KeyData{}
-	err = row.Scan(&key.FileName, &key.Modality, &key.Ip, &key.SVirtualDir)
+	err := row.Scan(&key.FileName, &key.Modality, &key.Ip, &key.SVirtualDir)
 	if err != nil {
 		global.Logger.Error(err)
 		return
@@ -152,97 +220,51 @@ func GetFileInfo(instancekey int64) (info global.FileInfo) {
 	return
 }
 
-// 更新异常的DCM字段
-func UpdateLocalStatus(key int64) {
-	sql := ""
-	switch global.ObjectSetting.OBJECT_Store_Type {
-	case global.PublicCloud:
-		sql = `update file_remote fr set fr.dcm_file_exist_obs_cloud = 4 where fr.instance_key = ?;`
-	case global.PrivateCloud:
-		sql = `update file_remote fr set fr.dcm_file_exist_obs_local = 4 where fr.instance_key = ?;`
-	}
-	err := global.WriteDBEngine.Ping()
-	if err != nil {
-		global.Logger.Error("WriteDBEngine.ping() err: ", err)
-		global.WriteDBEngine.Close()
-		global.WriteDBEngine, _ = NewDBEngine(global.DatabaseSetting)
-	}
-	global.WriteDBEngine.Exec(sql, key)
-}
-
-// 更新不存在的JPG字段
-func UpdateLocalJPGStatus(key int64) {
-	sql := ""
-	switch global.ObjectSetting.OBJECT_Store_Type {
-	case global.PublicCloud:
-		sql = `update file_remote fr set fr.img_file_exist_obs_cloud = 4 where fr.instance_key = ?;`
-	case global.PrivateCloud:
-		sql = `update file_remote fr set fr.img_file_exist_obs_local = 4 where fr.instance_key = ?;`
-	}
-	err := global.WriteDBEngine.Ping()
-	if err != nil {
-		global.Logger.Error("WriteDBEngine.ping() err: ", err)
-		global.WriteDBEngine.Close()
-		global.WriteDBEngine, _ = NewDBEngine(global.DatabaseSetting)
-	}
-	global.WriteDBEngine.Exec(sql, key)
-}
-
 // 上传数据后更新数据库
-func UpdateUplaod(key int64, filetype global.FileType, remotekey string, status bool) {
-	// 获取更新时时间
-	err := global.WriteDBEngine.Ping()
-	if err != nil {
-		global.Logger.Error("WriteDBEngine.ping() err: ", err)
-		global.WriteDBEngine.Close()
-		global.WriteDBEngine, _ = NewDBEngine(global.DatabaseSetting)
+// sha256 为整个文件的SHA-256，partSha256/partSize 为分段上传对象的组合校验和（各分段SHA-256拼接后的SHA-256加 -分段数）及分段大小，
+// 上传成功时写入 dcm/img_file_sha256、dcm/img_file_part_sha256、dcm/img_file_part_size 供后续核查，没有时写入null
+// 返回是否更新，认领已失效（已被其他实例认领）时不更新
+func UpdateUplaod(ctx context.Context, key int64, filetype global.FileType, remotekey string, sha256, partSha256 string, partSize int64, status bool) bool {
+	if !status {
+		global.Logger.Info("***", filetype, "数据上传失败，更新状态*** ", key)
+		return Transition(ctx, key, filetype, StatusFailed, "")
+	}
+	global.Logger.Info("***", filetype, "数据上传成功，更新状态*** ", key)
+	prefix := claimPrefix(filetype)
+	checksums := `,fr.` + prefix + `_file_sha256 = ?,fr.` + prefix + `_file_part_sha256 = ?,fr.` + prefix + `_file_part_size = ?`
+	checksumArgs := []interface{}{
+		sql.NullString{String: sha256, Valid: sha256 != ""},
+		sql.NullString{String: partSha256, Valid: partSha256 != ""},
+		sql.NullInt64{Int64: partSize, Valid: partSize > 0},
 	}
+	updated := false
 	switch global.ObjectSetting.OBJECT_Store_Type {
 	case global.PublicCloud:
 		switch filetype {
 		case global.DCM:
-			if status {
-				global.Logger.Info("***公有云DCM数据上传成功，更新状态*** ", key)
-				sql := `update file_remote fr set fr.dcm_file_exist_obs_cloud = ?,fr.dcm_location_code_obs_cloud = ?,fr.dcm_update_time_obs_cloud = now(),fr.dcm_file_name_remote = ? where fr.instance_key = ?;`
-				global.WriteDBEngine.Exec(sql, 1, global.ObjectSetting.OBJECT_Upload_Success_Code, remotekey, key)
-			} else {
-				global.Logger.Info("***公有云DCM数据上传失败，更新状态*** ", key)
-				sql := `update file_remote fr set fr.dcm_file_exist_obs_cloud = ? where fr.instance_key = ?;`
-				global.WriteDBEngine.Exec(sql, 2, key)
-			}
+			updated = Transition(ctx, key, filetype, StatusUploaded, `fr.dcm_location_code_obs_cloud = ?,fr.dcm_update_time_obs_cloud = now(),fr.dcm_file_name_remote = ?`+checksums,
+				append([]interface{}{global.ObjectSetting.OBJECT_Upload_Success_Code, remotekey}, checksumArgs...)...)
 		case global.JPG:
-			if status {
-				global.Logger.Info("***公有云JPG数据上传成功，更新状态*** ", key)
-				sql := `update file_remote fr set fr.img_file_exist_obs_cloud = ?,fr.img_update_time_obs_cloud = now(),fr.img_file_name_remote=? where fr.instance_key = ?;`
-				global.WriteDBEngine.Exec(sql, 1, remotekey, key)
-			} else {
-				global.Logger.Info("***公有云JPG数据上传失败，更新状态*** ", key)
-				sql := `update file_remote fr set fr.img_file_exist_obs_cloud = ? where fr.instance_key = ?;`
-				global.WriteDBEngine.Exec(sql, 2, key)
-			}
+			updated = Transition(ctx, key, filetype, StatusUploaded, `fr.img_update_time_obs_cloud = now(),fr.img_file_name_remote=?`+checksums,
+				append([]interface{}{remotekey}, checksumArgs...)...)
 		}
 	case global.PrivateCloud:
 		switch filetype {
 		case global.DCM:
-			if status {
-				global.Logger.Info("***私有云DCM数据上传成功，更新状态*** ", key)
-				sql := `update file_remote fr set fr.dcm_file_exist_obs_local = ?,fr.dcm_location_code_obs_local = ?,fr.dcm_update_time_obs_local = now(),fr.dcm_file_name_remote = ? where fr.instance_key = ?;`
-				global.WriteDBEngine.Exec(sql, 1, global.ObjectSetting.OBJECT_Upload_Success_Code, remotekey, key)
-			} else {
-				global.Logger.Info("***私有云DCM数据上传失败，更新状态*** ", key)
-				sql := `update file_remote fr set fr.dcm_file_exist_obs_local = ? where fr.instance_key = ?;`
-				global.WriteDBEngine.Exec(sql, 2, key)
-			}
+			updated = Transition(ctx, key, filetype, StatusUploaded, `fr.dcm_location_code_obs_local = ?,fr.dcm_update_time_obs_local = now(),fr.dcm_file_name_remote = ?`+checksums,
+				append([]interface{}{global.ObjectSetting.OBJECT_Upload_Success_Code, remotekey}, checksumArgs...)...)
 		case global.JPG:
-			if status {
-				global.Logger.Info("***私有云JPG数据上传成功，更新状态*** ", key)
-				sql := `update file_remote fr set fr.img_file_exist_obs_local = ?,fr.img_update_time_obs_local = now(),fr.img_file_name_remote=? where fr.instance_key = ?;`
-				global.WriteDBEngine.Exec(sql, 1, remotekey, key)
-			} else {
-				global.Logger.Info("***私有云JPG数据上传失败，更新状态*** ", key)
-				sql := `update file_remote fr set fr.img_file_exist_obs_local = ? where fr.instance_key = ?;`
-				global.WriteDBEngine.Exec(sql, 2, key)
-			}
+			updated = Transition(ctx, key, filetype, StatusUploaded, `fr.img_update_time_obs_local = now(),fr.img_file_name_remote=?`+checksums,
+				append([]interface{}{remotekey}, checksumArgs...)...)
 		}
 	}
+	if updated {
+		clearFailure(ctx, key, filetype)
+	}
+	return updated
+}
+
+// 更新上传状态字段（dcm/img 按文件类型，cloud/local 按存储类型）
+func UpdateRemoteStatus(ctx context.Context, key int64, filetype global.FileType, status UploadStatus) {
+	Transition(ctx, key, filetype, status, "")
 }
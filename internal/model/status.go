@@ -0,0 +1,183 @@
+package model
+
+import (
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/global"
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// 上传状态（file_remote 中 dcm/img_file_exist_obs_cloud/local 字段的值）
+// 待上传 → 上传中 → 上传成功/上传失败/跳过/源文件不存在/远端校验失败，结束状态可以重置为待上传（手动上传或重试），
+// 上传失败多次重试后更新为永久失败
+type UploadStatus int
+
+const (
+	StatusPending         UploadStatus = 0 // 待上传
+	StatusUploaded        UploadStatus = 1 // 上传成功
+	StatusFailed          UploadStatus = 2 // 上传失败
+	StatusInProgress      UploadStatus = 3 // 上传中（已被实例认领）
+	StatusSkippedInvalid  UploadStatus = 4 // 跳过：找不到文件信息（instance/study_location 数据异常）
+	StatusVerifyFailed    UploadStatus = 5 // 远端校验失败（上传接口返回成功，但远端对象不存在或大小/校验和不一致）
+	StatusSkippedModality UploadStatus = 6 // 跳过：检查类型不需要上传（UploadImgFlag）
+	StatusMissingSource   UploadStatus = 7 // 源文件不存在
+	StatusParked          UploadStatus = 8 // 永久失败：定时重试次数达到上限，不再自动重试
+)
+
+func (s UploadStatus) String() string {
+	switch s {
+	case StatusPending:
+		return "pending"
+	case StatusUploaded:
+		return "uploaded"
+	case StatusFailed:
+		return "failed"
+	case StatusInProgress:
+		return "in-progress"
+	case StatusSkippedInvalid:
+		return "skipped-invalid"
+	case StatusVerifyFailed:
+		return "verify-failed"
+	case StatusSkippedModality:
+		return "skipped-modality"
+	case StatusMissingSource:
+		return "missing-source"
+	case StatusParked:
+		return "parked"
+	}
+	return "unknown(" + strconv.Itoa(int(s)) + ")"
+}
+
+// 结束状态
+var finalStatus = []UploadStatus{
+	StatusUploaded,
+	StatusFailed,
+	StatusSkippedInvalid,
+	StatusVerifyFailed,
+	StatusSkippedModality,
+	StatusMissingSource,
+	StatusParked,
+}
+
+// 允许迁移到各状态的原状态
+// 上传中的数据只有租约过期后才能被重新认领（上传中 → 上传中），由 Transition 额外判断
+var transitions = map[UploadStatus][]UploadStatus{
+	StatusPending:         append([]UploadStatus{StatusInProgress}, finalStatus...),
+	StatusInProgress:      {StatusPending, StatusInProgress},
+	StatusUploaded:        {StatusInProgress},
+	StatusFailed:          {StatusInProgress},
+	StatusSkippedInvalid:  {StatusInProgress},
+	StatusVerifyFailed:    {StatusInProgress},
+	StatusSkippedModality: {StatusInProgress},
+	StatusMissingSource:   {StatusInProgress},
+	StatusParked:          {StatusFailed},
+}
+
+// 是否允许从 from 迁移到 to
+func CanTransition(from, to UploadStatus) bool {
+	for _, s := range transitions[to] {
+		if s == from {
+			return true
+		}
+	}
+	return false
+}
+
+// 允许迁移到 to 的原状态，用于 sql 的 in 条件
+func fromStatus(to UploadStatus) string {
+	list := make([]string, 0, len(transitions[to]))
+	for _, s := range transitions[to] {
+		list = append(list, strconv.Itoa(int(s)))
+	}
+	return strings.Join(list, ",")
+}
+
+// 上传状态字段：按文件类型区分 dcm/img，按存储类型区分 cloud/local
+func statusColumn(filetype global.FileType) string {
+	column := claimPrefix(filetype) + "_file_exist_obs_cloud"
+	if global.ObjectSetting.OBJECT_Store_Type == global.PrivateCloud {
+		column = claimPrefix(filetype) + "_file_exist_obs_local"
+	}
+	return column
+}
+
+// 查询当前上传状态
+func GetStatus(ctx context.Context, key int64, filetype global.FileType) (UploadStatus, bool) {
+	query := `select fr.` + statusColumn(filetype) + ` from file_remote fr where fr.instance_key = ?;`
+	CheckWriteDB(ctx)
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	var status UploadStatus
+	if err := global.WriteDBEngine.QueryRowContext(ctx, query, key).Scan(&status); err != nil {
+		global.Logger.Error("查询上传状态失败: ", key, " err: ", err)
+		return 0, false
+	}
+	return status, true
+}
+
+// 执行 sql 的数据库或事务
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// 按状态迁移表更新 where 选中的数据，返回更新的条数
+// sets/args 为同时更新的其他字段及其参数，where/whereArgs 为选择数据的条件（如 "fr.instance_key = ?"）；
+// 迁移到上传中时必须同时设置认领者和租约（由认领函数传入），迁移到其他状态时清除认领；
+// 从上传中迁移到其他状态时要求认领者仍是本实例，租约过期后已被其他实例认领的数据不更新（认领已失效）
+func transition(ctx context.Context, db execer, filetype global.FileType, to UploadStatus, sets string, args []interface{}, where string, whereArgs ...interface{}) (int64, error) {
+	column := statusColumn(filetype)
+	prefix := claimPrefix(filetype)
+	query := `update file_remote fr set fr.` + column + ` = ?`
+	if sets != "" {
+		query += `,` + sets
+	}
+	if to != StatusInProgress {
+		query += `,fr.` + prefix + `_claim_owner = null,fr.` + prefix + `_claim_expire = null`
+	}
+	query += ` where ` + where + ` and fr.` + column + ` in (` + fromStatus(to) + `)`
+	if to == StatusInProgress {
+		query += ` and (fr.` + column + ` <> ` + strconv.Itoa(int(StatusInProgress)) + ` or fr.` + prefix + `_claim_expire is null or fr.` + prefix + `_claim_expire < now())`
+	} else {
+		query += ` and (fr.` + column + ` <> ` + strconv.Itoa(int(StatusInProgress)) + ` or fr.` + prefix + `_claim_owner = ?)`
+	}
+	query += `;`
+	params := append([]interface{}{to}, args...)
+	params = append(params, whereArgs...)
+	if to != StatusInProgress {
+		params = append(params, ClaimOwner())
+	}
+	result, err := db.ExecContext(ctx, query, params...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// 状态迁移：只有当前状态允许迁移到 to 时才更新，返回是否更新
+// sets 为同时更新的其他字段（如 "fr.dcm_file_name_remote = ?"），args 为其参数，其他规则见 transition
+func Transition(ctx context.Context, key int64, filetype global.FileType, to UploadStatus, sets string, args ...interface{}) bool {
+	CheckWriteDB(ctx)
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	n, err := transition(ctx, global.WriteDBEngine, filetype, to, sets, args, `fr.instance_key = ?`, key)
+	if err != nil {
+		global.Logger.Error("更新上传状态失败: ", key, " 类型: ", filetype, " 状态: ", to, " err: ", err)
+		return false
+	}
+	if to != StatusInProgress {
+		claims.Lock()
+		delete(claims.m, claimKey{key, filetype})
+		claims.Unlock()
+	}
+	if n == 0 {
+		if CanTransition(StatusInProgress, to) {
+			global.Logger.Warn("认领已失效或上传状态不允许迁移到 ", to, "，不更新状态: ", key, " 类型: ", filetype, " 认领者: ", ClaimOwner())
+		} else {
+			global.Logger.Warn("上传状态不允许迁移到 ", to, ": ", key, " 类型: ", filetype)
+		}
+		return false
+	}
+	global.Logger.Info("更新上传状态: ", key, " 类型: ", filetype, " 状态: ", to)
+	return true
+}
@@ -0,0 +1,84 @@
+package model
+
+import (
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/global"
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/setting"
+	"context"
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 记录执行的 sql 和参数
+type recordExecer struct {
+	query string
+	args  []interface{}
+}
+
+func (r *recordExecer) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	r.query, r.args = query, args
+	return driverResult(1), nil
+}
+
+type driverResult int64
+
+func (r driverResult) LastInsertId() (int64, error) { return 0, nil }
+func (r driverResult) RowsAffected() (int64, error) { return int64(r), nil }
+
+func TestTransitionQuery(t *testing.T) {
+	oldObject, oldGeneral := global.ObjectSetting, global.GeneralSetting
+	defer func() { global.ObjectSetting, global.GeneralSetting = oldObject, oldGeneral }()
+	global.ObjectSetting = &setting.ObjectSettingS{OBJECT_Store_Type: global.PublicCloud}
+	global.GeneralSetting = &setting.GeneralSettingS{ClaimOwner: "node1", ClaimLease: 60}
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		run    func(db execer) error
+		query  []string
+		params []interface{}
+	}{
+		{
+			name: "批量认领",
+			run: func(db execer) error {
+				sets, args := claimSets(global.DCM)
+				_, err := transition(ctx, db, global.DCM, StatusInProgress, sets, args, `fr.instance_key in (?,?)`, int64(1), int64(2))
+				return err
+			},
+			query: []string{
+				`set fr.dcm_file_exist_obs_cloud = ?,fr.dcm_claim_owner = ?,fr.dcm_claim_expire = date_add(now(), interval ? second) where`,
+				`where fr.instance_key in (?,?) and fr.dcm_file_exist_obs_cloud in (` + fromStatus(StatusInProgress) + `)`,
+				`fr.dcm_claim_expire < now())`,
+			},
+			params: []interface{}{StatusInProgress, "node1", 60, int64(1), int64(2)},
+		},
+		{
+			name: "释放认领",
+			run: func(db execer) error {
+				_, err := transition(ctx, db, global.JPG, StatusPending, "", nil, `fr.img_claim_owner = ? and fr.img_file_exist_obs_cloud = 3`, "node1")
+				return err
+			},
+			query: []string{
+				`set fr.img_file_exist_obs_cloud = ?,fr.img_claim_owner = null,fr.img_claim_expire = null where`,
+				`where fr.img_claim_owner = ? and fr.img_file_exist_obs_cloud = 3 and fr.img_file_exist_obs_cloud in (` + fromStatus(StatusPending) + `)`,
+				`and (fr.img_file_exist_obs_cloud <> 3 or fr.img_claim_owner = ?)`,
+			},
+			params: []interface{}{StatusPending, "node1", "node1"},
+		},
+	}
+	for _, tt := range tests {
+		db := &recordExecer{}
+		if err := tt.run(db); err != nil {
+			t.Fatal(err)
+		}
+		for _, q := range tt.query {
+			if !strings.Contains(db.query, q) {
+				t.Errorf("%s: sql %q 缺少 %q", tt.name, db.query, q)
+			}
+		}
+		if !reflect.DeepEqual(db.args, tt.params) {
+			t.Errorf("%s: 参数 = %v, want %v", tt.name, db.args, tt.params)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package model
+
+import (
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/global"
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/metrics"
+	"context"
+	"database/sql"
+	"strconv"
+)
+
+// 上传失败数据定时重试
+// 上传失败（状态2）的数据在冷却时间后重置为待上传，冷却时间随重试次数增加：RetrySweepBaseDelay * 2^重试次数，不超过 RetrySweepMaxDelay；
+// 重试次数达到 RetrySweepMax 后更新为永久失败（状态8），不再自动重试，可通过管理接口手动上传
+// 重置后的数据在数据获取的扫描位置到达该 instance_key（或回到起点）时重新获取
+func RetrySweep(ctx context.Context) {
+	for _, filetype := range []global.FileType{global.DCM, global.JPG} {
+		if filetype == global.JPG && !global.ObjectSetting.JPG_Upload_Enable {
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		retrySweep(ctx, filetype)
+	}
+}
+
+func retrySweep(ctx context.Context, filetype global.FileType) {
+	batch := global.GeneralSetting.RetrySweepBatch
+	if batch <= 0 {
+		batch = 100
+	}
+	base := global.GeneralSetting.RetrySweepBaseDelay
+	if base <= 0 {
+		base = 30
+	}
+	max := global.GeneralSetting.RetrySweepMaxDelay
+	if max <= 0 {
+		max = 24 * 60
+	}
+	maxRetry := global.GeneralSetting.RetrySweepMax
+	if maxRetry <= 0 {
+		maxRetry = 5
+	}
+	// 没有失败记录的数据（增加失败记录前失败的数据）视为未重试过且已过冷却时间
+	column := statusColumn(filetype)
+	query := `select fr.instance_key,coalesce(f.retry_count,0) from file_remote fr
+	left join file_remote_failure f on f.instance_key = fr.instance_key and f.file_type = ? and f.store_type = ?
+	where fr.` + column + ` = ` + strconv.Itoa(int(StatusFailed)) + `
+	and (f.instance_key is null or f.retry_count >= ? or f.last_attempt_time < date_sub(now(), interval least(? * pow(2, f.retry_count), ?) minute))
+	order by fr.instance_key
+	limit ?;`
+	if !CheckWriteDB(ctx) {
+		return
+	}
+	qctx, cancel := queryContext(ctx)
+	rows, err := global.WriteDBEngine.QueryContext(qctx, query, filetype, global.ObjectSetting.OBJECT_Store_Type,
+		maxRetry, base, max, batch)
+	if err != nil {
+		cancel()
+		global.Logger.Error("查询需要重试的失败数据失败: ", err)
+		return
+	}
+	type failed struct {
+		key   int64
+		count int
+	}
+	var list []failed
+	for rows.Next() {
+		var key sql.NullInt64
+		var count int
+		if err = rows.Scan(&key, &count); err != nil {
+			global.Logger.Error("rows.Scan error: ", err)
+			continue
+		}
+		list = append(list, failed{key.Int64, count})
+	}
+	rows.Close()
+	cancel()
+
+	var requeued, parked int
+	for _, f := range list {
+		if ctx.Err() != nil {
+			break
+		}
+		if f.count >= maxRetry {
+			if Transition(ctx, f.key, filetype, StatusParked, "") {
+				global.Logger.Warn("超过最大重试次数，更新为永久失败: ", f.key, " 类型: ", filetype, " 重试次数: ", f.count)
+				metrics.RetrySweep.WithLabelValues(filetype.String(), "parked").Inc()
+				parked++
+			}
+			continue
+		}
+		if Transition(ctx, f.key, filetype, StatusPending, "") {
+			addRetryCount(ctx, f.key, filetype)
+			metrics.RetrySweep.WithLabelValues(filetype.String(), "requeued").Inc()
+			requeued++
+		}
+	}
+	if requeued > 0 || parked > 0 {
+		global.Logger.Info("失败数据重试: ", filetype, " 重置为待上传: ", requeued, " 永久失败: ", parked)
+	}
+}
+
+// 定时重试次数加一
+func addRetryCount(ctx context.Context, key int64, filetype global.FileType) {
+	query := `insert into file_remote_failure (instance_key,file_type,store_type,retry_count) values (?,?,?,1)
+	on duplicate key update retry_count = retry_count + 1;`
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	_, err := global.WriteDBEngine.ExecContext(ctx, query, key, filetype, global.ObjectSetting.OBJECT_Store_Type)
+	if err != nil {
+		global.Logger.Error("更新重试次数失败: ", key, " err: ", err)
+	}
+}
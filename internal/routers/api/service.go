@@ -0,0 +1,142 @@
+package api
+
+import (
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/global"
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/internal/model"
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/app"
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/convert"
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/errcode"
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/workpattern"
+	"net/http"
+	"strings"
+)
+
+// 服务管理接口
+type Service struct {
+	pool *workpattern.WorkerPool
+}
+
+func NewService(pool *workpattern.WorkerPool) Service {
+	return Service{pool: pool}
+}
+
+// 服务状态
+type StatusResponse struct {
+	global.StatusInfo
+	Workers     int `json:"workers"`
+	BusyWorkers int `json:"busyWorkers"`
+	QueueDepth  int `json:"queueDepth"`
+	// 自适应并发控制的当前并发上限
+	ConcurrencyLimit int `json:"concurrencyLimit"`
+}
+
+// @Summary 查询服务状态
+// @Produce json
+// @Success 200 {object} StatusResponse "成功"
+// @Router /api/v1/status [get]
+func (s Service) Status(w http.ResponseWriter, r *http.Request) {
+	app.NewResponse(w).ToResponse(StatusResponse{
+		StatusInfo:       global.State.Status(),
+		Workers:          s.pool.Workers(),
+		BusyWorkers:      s.pool.Busy(),
+		QueueDepth:       s.pool.Queued(),
+		ConcurrencyLimit: s.pool.Limit(),
+	})
+}
+
+// @Summary 暂停定时任务
+// @Produce json
+// @Router /api/v1/cron/pause [post]
+func (s Service) Pause(w http.ResponseWriter, r *http.Request) {
+	global.State.Pause()
+	global.Logger.Info("***管理接口暂停定时任务***")
+	app.NewResponse(w).ToResponse(global.State.Status())
+}
+
+// @Summary 恢复定时任务
+// @Produce json
+// @Router /api/v1/cron/resume [post]
+func (s Service) Resume(w http.ResponseWriter, r *http.Request) {
+	global.State.Resume()
+	global.Logger.Info("***管理接口恢复定时任务***")
+	app.NewResponse(w).ToResponse(global.State.Status())
+}
+
+// @Summary 立即执行一次数据获取
+// @Produce json
+// @Router /api/v1/discovery [post]
+func (s Service) Discovery(w http.ResponseWriter, r *http.Request) {
+	response := app.NewResponse(w)
+	if !global.State.Trigger() {
+		response.ToErrorResponse(errcode.TooManyRequests.WithDetails("已有待执行的数据获取请求"))
+		return
+	}
+	global.Logger.Info("***管理接口触发数据获取***")
+	response.ToResponse(map[string]interface{}{"triggered": true})
+}
+
+// @Summary 按 instance_key 手动上传
+// @Produce json
+// @Param instance_key query int true "instance_key"
+// @Param type query string false "文件类型：dcm（默认）、jpg"
+// @Router /api/v1/upload [post]
+func (s Service) Upload(w http.ResponseWriter, r *http.Request) {
+	response := app.NewResponse(w)
+	key, filetype, perr := instanceParams(r)
+	if perr != nil {
+		response.ToErrorResponse(perr)
+		return
+	}
+	data, ok := model.GetInstanceData(r.Context(), key, filetype)
+	if !ok {
+		response.ToErrorResponse(errcode.NotFound.WithDetails("找不到 instance_key 对应的文件信息"))
+		return
+	}
+	// 先认领数据，避免与其他实例或正在执行的任务重复上传
+	if !model.ClaimInstance(r.Context(), key, filetype) {
+		response.ToErrorResponse(errcode.Conflict.WithDetails("数据正在上传中"))
+		return
+	}
+	global.Logger.Info("***管理接口手动上传***: ", data)
+	// 工作池繁忙时放入队列会阻塞，不等待放入完成
+	go func() {
+		global.ObjectDataChan <- data
+	}()
+	response.ToResponse(data)
+}
+
+// @Summary 按 instance_key 查询上传失败原因
+// @Produce json
+// @Param instance_key query int true "instance_key"
+// @Param type query string false "文件类型：dcm（默认）、jpg"
+// @Success 200 {object} model.UploadFailure "成功"
+// @Router /api/v1/failure [get]
+func (s Service) Failure(w http.ResponseWriter, r *http.Request) {
+	response := app.NewResponse(w)
+	key, filetype, perr := instanceParams(r)
+	if perr != nil {
+		response.ToErrorResponse(perr)
+		return
+	}
+	failure, ok := model.GetFailure(r.Context(), key, filetype)
+	if !ok {
+		response.ToErrorResponse(errcode.NotFound.WithDetails("没有上传失败记录"))
+		return
+	}
+	response.ToResponse(failure)
+}
+
+// 解析 instance_key 和文件类型参数
+func instanceParams(r *http.Request) (int64, global.FileType, *errcode.Error) {
+	key, err := convert.StrTo(r.FormValue("instance_key")).Int()
+	if err != nil || key <= 0 {
+		return 0, 0, errcode.InvalidParams.WithDetails("instance_key 错误")
+	}
+	switch strings.ToLower(r.FormValue("type")) {
+	case "", "dcm":
+		return int64(key), global.DCM, nil
+	case "jpg":
+		return int64(key), global.JPG, nil
+	}
+	return 0, 0, errcode.InvalidParams.WithDetails("type 只能是 dcm 或 jpg")
+}
@@ -0,0 +1,57 @@
+package routers
+
+import (
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/global"
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/internal/routers/api"
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/app"
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/errcode"
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/metrics"
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/workpattern"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// 管理接口路由
+func NewRouter(pool *workpattern.WorkerPool) http.Handler {
+	mux := http.NewServeMux()
+	service := api.NewService(pool)
+	mux.HandleFunc("/api/v1/status", adminAuth(allowMethod(http.MethodGet, service.Status)))
+	mux.HandleFunc("/api/v1/cron/pause", adminAuth(allowMethod(http.MethodPost, service.Pause)))
+	mux.HandleFunc("/api/v1/cron/resume", adminAuth(allowMethod(http.MethodPost, service.Resume)))
+	mux.HandleFunc("/api/v1/discovery", adminAuth(allowMethod(http.MethodPost, service.Discovery)))
+	mux.HandleFunc("/api/v1/upload", adminAuth(allowMethod(http.MethodPost, service.Upload)))
+	mux.HandleFunc("/api/v1/failure", adminAuth(allowMethod(http.MethodGet, service.Failure)))
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		app.NewResponse(w).ToErrorResponse(errcode.NotFound)
+	})
+	return mux
+}
+
+// 管理接口鉴权：配置了 AdminToken 时校验请求头 Authorization: Bearer <AdminToken>
+func adminAuth(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := global.ServerSetting.AdminToken
+		if token != "" {
+			auth := r.Header.Get("Authorization")
+			if !strings.HasPrefix(auth, "Bearer ") ||
+				subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) != 1 {
+				app.NewResponse(w).ToErrorResponse(errcode.UnauthorizedTokenError)
+				return
+			}
+		}
+		handler(w, r)
+	}
+}
+
+// 限制请求方法
+func allowMethod(method string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			app.NewResponse(w).ToErrorResponse(errcode.MethodNotAllowed)
+			return
+		}
+		handler(w, r)
+	}
+}
@@ -3,9 +3,17 @@ package main
 import (
 	"WowjoyProject/ObjectCloudService_Upload_Dicom/global"
 	"WowjoyProject/ObjectCloudService_Upload_Dicom/internal/model"
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/internal/routers"
 	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/object"
 	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/workpattern"
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
 	"runtime"
+	"syscall"
+	"time"
 
 	"github.com/robfig/cron"
 )
@@ -16,11 +24,21 @@ import (
 // @termsOfService https://github.com/jianghuxiaoloulou/ObjectCloudService_Upload.git
 func main() {
 	global.Logger.Info("***开始运行存储策略上传服务***")
-	// global.TargetValue = global.ObjectSetting.OBJECT_START_KEY
 	global.ObjectDataChan = make(chan global.ObjectData)
 	// 注册工作池，传入任务
 	// 参数1 初始化worker(工人)设置最大线程数
 	wokerPool := workpattern.NewWorkerPool(global.GeneralSetting.MaxThreads)
+	// 根据上传结果自适应调整并发上传数
+	if global.GeneralSetting.AdaptiveLimit {
+		limiter := workpattern.NewAIMDLimiter(
+			global.GeneralSetting.AdaptiveMinThreads,
+			global.GeneralSetting.MaxThreads,
+			global.GeneralSetting.AdaptiveDecrease,
+			time.Duration(global.GeneralSetting.AdaptiveCooldown)*time.Second,
+		)
+		wokerPool.SetLimiter(limiter)
+		object.SetFeedback(limiter)
+	}
 	// 有任务就去做，没有就阻塞，任务做不过来也阻塞
 	wokerPool.Run()
 	// 处理任务
@@ -28,27 +46,112 @@ func main() {
 		for {
 			select {
 			case data := <-global.ObjectDataChan:
+				// 停止服务后继续读取任务通道，避免放入任务的协程阻塞，任务不再执行，重启后重新获取
 				sc := &Dosomething{key: data}
-				wokerPool.JobQueue <- sc
+				if global.State.Stopping() || !wokerPool.Submit(sc) {
+					global.Logger.Info("服务正在停止，丢弃任务: ", data.InstanceKey)
+				}
 			}
 		}
 	}()
-	global.RunStatus = false
-	run()
+	// 启动管理接口
+	server := runServer(wokerPool)
+	// 停止服务时取消数据获取
+	ctx, cancel := context.WithCancel(context.Background())
+	// 监听退出信号
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		sig := <-quit
+		global.Logger.Info("***收到退出信号，开始停止服务***: ", sig)
+		global.State.Stop()
+		cancel()
+	}()
+	// 释放上次运行遗留的认领，处理期间为认领的数据续租，停止服务等待任务完成后再停止续租
+	model.ReleaseClaims(context.Background())
+	renewCtx, stopRenew := context.WithCancel(context.Background())
+	go model.RenewClaims(renewCtx)
+	run(ctx)
+	shutdown(wokerPool, server, stopRenew)
+}
+
+func runServer(pool *workpattern.WorkerPool) *http.Server {
+	s := &http.Server{
+		Addr:           serverAddr(),
+		Handler:        routers.NewRouter(pool),
+		ReadTimeout:    global.ServerSetting.ReadTimeout,
+		WriteTimeout:   global.ServerSetting.WriteTimeout,
+		MaxHeaderBytes: 1 << 20,
+	}
+	global.Logger.Info("***管理接口启动***: ", s.Addr)
+	if global.ServerSetting.AdminToken == "" && !isLoopback(global.ServerSetting.HttpAddr) {
+		global.Logger.Warn("管理接口监听非本机地址且未配置 AdminToken，任何人都可以访问管理接口")
+	}
+	go func() {
+		if err := s.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			global.Logger.Error("管理接口启动失败: ", err)
+		}
+	}()
+	return s
+}
+
+// 管理接口监听地址，未配置时只监听本机
+func serverAddr() string {
+	addr := global.ServerSetting.HttpAddr
+	if addr == "" {
+		addr = "127.0.0.1"
+	}
+	return net.JoinHostPort(addr, global.ServerSetting.HttpPort)
+}
+
+// 是否只监听本机
+func isLoopback(addr string) bool {
+	if addr == "" || addr == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(addr)
+	return ip != nil && ip.IsLoopback()
+}
+
+// 停止服务：关闭管理接口，等待工作池中的任务完成，中断未完成的分段上传，释放未处理完成的认领后关闭数据库
+func shutdown(pool *workpattern.WorkerPool, server *http.Server, stopRenew context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := server.Shutdown(ctx); err != nil {
+		global.Logger.Error("关闭管理接口失败: ", err)
+	}
+	cancel()
+
+	timeout := time.Duration(global.GeneralSetting.ShutdownTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+	global.Logger.Info("等待正在执行的任务完成, 执行中: ", pool.Busy(), " 等待中: ", pool.Queued(), " 最长等待: ", timeout)
+	if pool.Stop(timeout) {
+		global.Logger.Info("任务已全部完成")
+	} else {
+		global.Logger.Warn("等待任务完成超时，中断未完成的任务, 执行中: ", pool.Busy())
+	}
+	object.Shutdown(10 * time.Second)
+	stopRenew()
+	model.ReleaseClaims(context.Background())
+
+	global.ReadDBEngine.Close()
+	global.WriteDBEngine.Close()
+	global.Logger.Info("***存储策略上传服务已停止***")
 }
 
 type Dosomething struct {
 	key global.ObjectData
 }
 
-func (d *Dosomething) Do() {
+func (d *Dosomething) Do(ctx context.Context) {
 	global.Logger.Info("正在处理的数据是：", d.key)
 	// 处理封装对象操作
 	obj := object.NewObject(d.key)
-	obj.UploadObject()
+	obj.UploadObject(ctx)
 }
 
-func run() {
+func run(ctx context.Context) {
 	// 方式一：
 	// for {
 	// 	// time.Sleep(time.Second * 10)
@@ -58,30 +161,55 @@ func run() {
 	// 方式二：获取任务(定时任务)
 	MyCron := cron.New()
 	MyCron.AddFunc(global.GeneralSetting.CronSpec, func() {
+		if global.State.Paused() || global.State.Stopping() {
+			global.Logger.Info("定时任务已暂停")
+			return
+		}
 		global.Logger.Info("开始执行定时任务")
-		work()
+		global.State.CronRun()
+		work(ctx)
 	})
+	// 上传失败数据定时重置为待上传
+	if spec := global.GeneralSetting.RetrySweepSpec; spec != "" {
+		err := MyCron.AddFunc(spec, func() {
+			if global.State.Paused() || global.State.Stopping() {
+				return
+			}
+			global.Logger.Info("开始执行失败数据重试")
+			model.RetrySweep(ctx)
+		})
+		if err != nil {
+			global.Logger.Error("失败数据重试定时规则错误: ", spec, " err: ", err)
+		}
+	}
 	MyCron.Start()
 	defer MyCron.Stop()
-	select {}
+	// 管理接口触发的数据获取，收到退出信号后返回
+	for {
+		select {
+		case <-global.State.Triggered():
+			global.Logger.Info("开始执行手动触发的任务")
+			work(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
 }
 
-func work() {
+func work(ctx context.Context) {
 	global.Logger.Debug("runtime.NumGoroutine :", runtime.NumGoroutine())
-	// 增加数据库的连接判断
-	if global.ReadDBEngine.Ping() == nil {
+	// 增加数据库的连接判断，数据库不可用时跳过本次数据获取
+	if model.CheckReadDB(ctx) {
 		switch global.ObjectSetting.OBJECT_Store_Type {
 		case global.PublicCloud:
 			global.Logger.Info("***公有云数据上传***")
-			model.GetUploadPublicData()
+			model.GetUploadPublicData(ctx)
 		case global.PrivateCloud:
 			global.Logger.Info("***私有云数据上传***")
-			model.GetUploadPrivateData()
+			model.GetUploadPrivateData(ctx)
 		}
 	} else {
-		global.Logger.Debug("数据库无效连接，重连数据库")
-		global.ReadDBEngine.Close()
-		setupReadDBEngine()
+		global.Logger.Debug("数据库无效连接，跳过本次数据获取")
 	}
 }
 
@@ -0,0 +1,41 @@
+package app
+
+// 接口响应
+
+import (
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/errcode"
+	"encoding/json"
+	"net/http"
+)
+
+type Response struct {
+	w http.ResponseWriter
+}
+
+func NewResponse(w http.ResponseWriter) *Response {
+	return &Response{w: w}
+}
+
+// 成功响应
+func (r *Response) ToResponse(data interface{}) {
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	r.write(http.StatusOK, data)
+}
+
+// 错误响应，HTTP状态码由 errcode.Error.StatusCode 映射
+func (r *Response) ToErrorResponse(err *errcode.Error) {
+	response := map[string]interface{}{"code": err.Code(), "msg": err.Msg()}
+	details := err.Details()
+	if len(details) > 0 {
+		response["details"] = details
+	}
+	r.write(err.StatusCode(), response)
+}
+
+func (r *Response) write(status int, data interface{}) {
+	r.w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	r.w.WriteHeader(status)
+	json.NewEncoder(r.w).Encode(data)
+}
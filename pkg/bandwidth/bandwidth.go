@@ -0,0 +1,175 @@
+package bandwidth
+
+// 上传带宽限制
+// 所有worker、所有分段共用一个令牌桶，按时间段配置不同的速率，修改配置后无需重启即可生效
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// 每次读取的最大字节数，避免一次读取消耗过多令牌导致长时间等待
+const maxChunk = 32 << 10
+
+// 时间段速率
+type Rule struct {
+	Start string  // 开始时间 HH:MM
+	End   string  // 结束时间 HH:MM，小于开始时间表示跨天
+	Rate  float64 // 速率（MB/s），0表示不限制
+}
+
+type rule struct {
+	start int // 分钟
+	end   int
+	rate  float64 // 字节/秒
+}
+
+func (r rule) match(minute int) bool {
+	if r.start <= r.end {
+		return minute >= r.start && minute < r.end
+	}
+	return minute >= r.start || minute < r.end
+}
+
+func parseClock(s string) (int, error) {
+	var hour, minute int
+	if _, err := fmt.Sscanf(s, "%d:%d", &hour, &minute); err != nil {
+		return 0, fmt.Errorf("时间格式错误: %s", s)
+	}
+	if hour < 0 || hour > 24 || minute < 0 || minute > 59 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("时间格式错误: %s", s)
+	}
+	return hour*60 + minute, nil
+}
+
+// 令牌桶
+type Limiter struct {
+	mu     sync.Mutex
+	def    float64 // 不在时间段内的速率（字节/秒），0表示不限制
+	rules  []rule
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func NewLimiter() *Limiter {
+	return &Limiter{}
+}
+
+// 所有上传共用的带宽限制
+var Default = NewLimiter()
+
+// 设置速率配置，def 和 Rule.Rate 单位为 MB/s，时间段按配置顺序匹配
+func (l *Limiter) SetSchedule(def float64, rules []Rule) error {
+	parsed := make([]rule, 0, len(rules))
+	for _, r := range rules {
+		start, err := parseClock(r.Start)
+		if err != nil {
+			return err
+		}
+		end, err := parseClock(r.End)
+		if err != nil {
+			return err
+		}
+		if r.Rate < 0 {
+			return fmt.Errorf("速率不能小于0: %v", r.Rate)
+		}
+		parsed = append(parsed, rule{start: start, end: end, rate: r.Rate * (1 << 20)})
+	}
+	if def < 0 {
+		return fmt.Errorf("速率不能小于0: %v", def)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.def = def * (1 << 20)
+	l.rules = parsed
+	l.update(time.Now())
+	return nil
+}
+
+// 当前速率（字节/秒），0表示不限制
+func (l *Limiter) Rate() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.update(time.Now())
+	return l.rate
+}
+
+// 按当前时间更新速率并补充令牌，调用时需持有锁
+func (l *Limiter) update(now time.Time) {
+	rate := l.def
+	minute := now.Hour()*60 + now.Minute()
+	for _, r := range l.rules {
+		if r.match(minute) {
+			rate = r.rate
+			break
+		}
+	}
+	if rate != l.rate {
+		l.rate = rate
+		// 速率变化后重新开始计算，不保留之前的令牌或欠账
+		l.tokens = 0
+		l.last = now
+	}
+	if l.rate <= 0 {
+		return
+	}
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	l.last = now
+	// 最多积累1秒的令牌
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+}
+
+// 消耗 n 个令牌，令牌不足时等待，ctx 取消时返回错误
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	l.mu.Lock()
+	l.update(time.Now())
+	if l.rate <= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	// 允许欠账，后来的读取排在后面等待，保证多个读取共享带宽
+	l.tokens -= float64(n)
+	wait := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// 限速读取
+type Reader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *Limiter
+}
+
+func NewReader(ctx context.Context, r io.Reader, limiter *Limiter) *Reader {
+	return &Reader{ctx: ctx, r: r, limiter: limiter}
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	if len(p) > maxChunk {
+		p = p[:maxChunk]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if werr := r.limiter.WaitN(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
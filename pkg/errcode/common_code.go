@@ -25,4 +25,6 @@ var (
 	UnauthorizedTokenTimeout  = NewError(10000005, "鉴权失败，Token 超时")
 	UnauthorizedTokenGenerate = NewError(10000006, "鉴权失败，Token 生成失败")
 	TooManyRequests           = NewError(10000007, "请求过多")
+	MethodNotAllowed          = NewError(10000008, "请求方法不支持")
+	Conflict                  = NewError(10000009, "数据状态冲突")
 )
@@ -6,9 +6,10 @@ import (
 )
 
 type Error struct {
-	code    int      `json:"code"`
-	msg     string   `json:"msg"`
-	details []string `json:"details"`
+	code    int
+	msg     string
+	details []string
+	cause   error // 原始错误，通过 errors.Is/As 判断错误类型
 }
 
 var codes = map[int]string{}
@@ -53,6 +54,17 @@ func (e *Error) WithDetails(details ...string) *Error {
 	return &newError
 }
 
+// 包装原始错误：原始错误信息作为详细信息，并保留原始错误
+func (e *Error) Wrap(err error) *Error {
+	newError := e.WithDetails(err.Error())
+	newError.cause = err
+	return newError
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
 func (e *Error) StatusCode() int {
 	switch e.Code() {
 	case Http_Success.Code():
@@ -61,6 +73,10 @@ func (e *Error) StatusCode() int {
 		return http.StatusInternalServerError
 	case InvalidParams.Code():
 		return http.StatusBadRequest
+	case NotFound.Code():
+		return http.StatusNotFound
+	case MethodNotAllowed.Code():
+		return http.StatusMethodNotAllowed
 	case UnauthorizedAuthNotExist.Code():
 		fallthrough
 	case UnauthorizedTokenError.Code():
@@ -71,6 +87,8 @@ func (e *Error) StatusCode() int {
 		return http.StatusUnauthorized
 	case TooManyRequests.Code():
 		return http.StatusTooManyRequests
+	case Conflict.Code():
+		return http.StatusConflict
 	}
 	return http.StatusInternalServerError
 }
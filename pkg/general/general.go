@@ -3,16 +3,17 @@ package general
 import (
 	"WowjoyProject/ObjectCloudService_Upload_Dicom/global"
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
-	"math"
 	"mime/multipart"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
 )
 
@@ -90,49 +91,77 @@ func CopyFile(src, dest string) (int64, error) {
 	return io.Copy(file2, file1)
 }
 
-func Exist(filename string) bool {
-	_, err := os.Stat(filename)
-	return err == nil || os.IsExist(err)
-}
-
-// 大文件分段
-func FileSplit(file string, size int64) map[int]string {
-	global.Logger.Debug("开始执行大文件分段", file)
-	fileMap := make(map[int]string)
-	fileSize := GetFileSize(file)
-	// 分段数
-	num := int(math.Ceil(float64(fileSize) / float64(size)))
-	// 分段
-	fi, err := os.OpenFile(file, os.O_RDONLY, os.ModePerm)
+// 原子写入文件（存储后端 fs 使用），与 CopyFile 不同，写入过程中目标文件不会出现不完整的内容
+// 先写入目标目录下的临时文件并 fsync，再重新读取临时文件校验大小和sha256，
+// 校验通过后重命名为目标文件，返回写入内容的sha256（十六进制）
+// size 小于0时不校验大小
+func WriteFileAtomic(dest string, src io.Reader, size int64) (string, error) {
+	// 判断路径文件夹是否存在，不存在，创建文件夹
+	CheckPath(dest)
+	dir, name := filepath.Split(dest)
+	temp, err := os.CreateTemp(dir, "."+name+".tmp-*")
 	if err != nil {
-		global.Logger.Error(err)
-		return fileMap
+		return "", err
 	}
-	b := make([]byte, size)
-	var i int = 1
-	for ; i <= num; i++ {
-
-		fi.Seek(int64(i-1)*(size), 0)
-
-		if len(b) > int((fileSize - int64(i-1)*size)) {
-			b = make([]byte, fileSize-int64(i-1)*size)
+	tempName := temp.Name()
+	success := false
+	defer func() {
+		if !success {
+			temp.Close()
+			os.Remove(tempName)
 		}
+	}()
 
-		fi.Read(b)
-		tempdir := global.ObjectSetting.File_Split_Temp
-		tempFile := tempdir + file[strings.LastIndex(file, "\\"):] + "_" + strconv.Itoa(int(i))
-		global.Logger.Debug(tempFile)
-		f, err := os.OpenFile(tempFile, os.O_CREATE|os.O_WRONLY, os.ModePerm)
-		if err != nil {
-			global.Logger.Error(err)
-			return fileMap
-		}
-		f.Write(b)
-		f.Close()
-		fileMap[i] = tempFile
+	hash := sha256.New()
+	written, err := io.Copy(temp, io.TeeReader(src, hash))
+	if err != nil {
+		return "", err
+	}
+	if size >= 0 && written != size {
+		return "", fmt.Errorf("写入文件大小不一致, 期望: %d, 实际: %d", size, written)
+	}
+	if err = temp.Sync(); err != nil {
+		return "", err
+	}
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	// 重新读取落盘内容校验
+	if _, err = temp.Seek(0, io.SeekStart); err != nil {
+		return "", err
 	}
-	fi.Close()
-	return fileMap
+	verify := sha256.New()
+	if _, err = io.Copy(verify, temp); err != nil {
+		return "", err
+	}
+	if hex.EncodeToString(verify.Sum(nil)) != checksum {
+		return "", fmt.Errorf("写入文件校验失败: %s", dest)
+	}
+	if err = temp.Close(); err != nil {
+		return "", err
+	}
+	if err = os.Rename(tempName, dest); err != nil {
+		return "", err
+	}
+	success = true
+	syncDir(dir)
+	return checksum, nil
+}
+
+// 同步目录项，保证重命名后断电不丢失（Windows 不支持对目录 fsync，忽略错误）
+func syncDir(dir string) {
+	if dir == "" {
+		dir = "."
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
+
+func Exist(filename string) bool {
+	_, err := os.Stat(filename)
+	return err == nil || os.IsExist(err)
 }
 
 func post(reqUrl string, reqParams map[string]string, contentType string, files []UploadFile, headers map[string]string) string {
@@ -0,0 +1,295 @@
+package metrics
+
+// Prometheus 文本格式指标（exposition format 0.0.4）
+// 只实现服务需要的 counter、gauge、histogram，避免引入完整的客户端库
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type metricType string
+
+const (
+	typeCounter   metricType = "counter"
+	typeGauge     metricType = "gauge"
+	typeHistogram metricType = "histogram"
+)
+
+// 默认耗时分桶（秒）
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300}
+
+type collector interface {
+	write(w io.Writer)
+}
+
+type registry struct {
+	mu         sync.Mutex
+	collectors []collector
+	names      map[string]bool
+}
+
+var defaultRegistry = &registry{names: make(map[string]bool)}
+
+func (r *registry) register(name string, c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] {
+		panic(fmt.Sprintf("指标 %s 已经存在", name))
+	}
+	r.names[name] = true
+	r.collectors = append(r.collectors, c)
+}
+
+func (r *registry) write(w io.Writer) {
+	r.mu.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// /metrics 接口
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		defaultRegistry.write(w)
+	})
+}
+
+// 同名指标的一组序列，按标签值区分
+type vec struct {
+	name   string
+	help   string
+	typ    metricType
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	values []string
+	mu     sync.Mutex
+	value  float64
+	// histogram
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func newVec(name, help string, typ metricType, labels []string) *vec {
+	v := &vec{
+		name:   name,
+		help:   help,
+		typ:    typ,
+		labels: labels,
+		series: make(map[string]*series),
+	}
+	defaultRegistry.register(name, v)
+	return v
+}
+
+func (v *vec) get(values []string, buckets []float64) *series {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("指标 %s 标签数量错误, 期望 %d, 实际 %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{values: append([]string(nil), values...)}
+		if buckets != nil {
+			s.buckets = buckets
+			s.counts = make([]uint64, len(buckets))
+		}
+		v.series[key] = s
+	}
+	return s
+}
+
+func (v *vec) sorted() []*series {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	list := make([]*series, 0, len(keys))
+	for _, k := range keys {
+		list = append(list, v.series[k])
+	}
+	return list
+}
+
+func (v *vec) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, escapeHelp(v.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.typ)
+	for _, s := range v.sorted() {
+		s.mu.Lock()
+		if v.typ == typeHistogram {
+			var cumulative uint64
+			for i, le := range s.buckets {
+				cumulative += s.counts[i]
+				fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, labelString(v.labels, s.values, "le", formatFloat(le)), cumulative)
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, labelString(v.labels, s.values, "le", "+Inf"), s.count)
+			fmt.Fprintf(w, "%s_sum%s %s\n", v.name, labelString(v.labels, s.values, "", ""), formatFloat(s.sum))
+			fmt.Fprintf(w, "%s_count%s %d\n", v.name, labelString(v.labels, s.values, "", ""), s.count)
+		} else {
+			fmt.Fprintf(w, "%s%s %s\n", v.name, labelString(v.labels, s.values, "", ""), formatFloat(s.value))
+		}
+		s.mu.Unlock()
+	}
+}
+
+func labelString(names, values []string, extraName, extraValue string) string {
+	pairs := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		pairs = append(pairs, name+`="`+escapeLabel(values[i])+`"`)
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+extraValue+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escapeLabel(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return strings.ReplaceAll(s, `"`, `\"`)
+}
+
+func escapeHelp(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return strings.ReplaceAll(s, "\n", `\n`)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// 计数器
+type CounterVec struct {
+	v *vec
+}
+
+type Counter struct {
+	s *series
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{v: newVec(name, help, typeCounter, labels)}
+}
+
+func (c *CounterVec) WithLabelValues(values ...string) Counter {
+	return Counter{s: c.v.get(values, nil)}
+}
+
+func (c Counter) Inc() {
+	c.Add(1)
+}
+
+// 计数器只能增加，负数忽略
+func (c Counter) Add(delta float64) {
+	if delta < 0 {
+		return
+	}
+	c.s.mu.Lock()
+	c.s.value += delta
+	c.s.mu.Unlock()
+}
+
+// 仪表
+type GaugeVec struct {
+	v *vec
+}
+
+type Gauge struct {
+	s *series
+}
+
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{v: newVec(name, help, typeGauge, labels)}
+}
+
+func (g *GaugeVec) WithLabelValues(values ...string) Gauge {
+	return Gauge{s: g.v.get(values, nil)}
+}
+
+func (g Gauge) Set(value float64) {
+	g.s.mu.Lock()
+	g.s.value = value
+	g.s.mu.Unlock()
+}
+
+func (g Gauge) Add(delta float64) {
+	g.s.mu.Lock()
+	g.s.value += delta
+	g.s.mu.Unlock()
+}
+
+func (g Gauge) Inc() {
+	g.Add(1)
+}
+
+func (g Gauge) Dec() {
+	g.Add(-1)
+}
+
+// 直方图
+type HistogramVec struct {
+	v       *vec
+	buckets []float64
+}
+
+type Histogram struct {
+	s *series
+}
+
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &HistogramVec{v: newVec(name, help, typeHistogram, labels), buckets: buckets}
+}
+
+func (h *HistogramVec) WithLabelValues(values ...string) Histogram {
+	return Histogram{s: h.v.get(values, h.buckets)}
+}
+
+func (h Histogram) Observe(value float64) {
+	h.s.mu.Lock()
+	defer h.s.mu.Unlock()
+	for i, le := range h.s.buckets {
+		if value <= le {
+			h.s.counts[i]++
+			break
+		}
+	}
+	h.s.count++
+	h.s.sum += value
+}
@@ -0,0 +1,305 @@
+package metrics
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// 解析后的样本
+type sample struct {
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+// 解析标签：{a="x",b="y"}，按 exposition format 反转义 \\ \" \n
+func parseLabels(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "{"), "}")
+	for len(s) > 0 {
+		eq := strings.Index(s, `="`)
+		if eq <= 0 {
+			return nil, fmt.Errorf("标签格式错误: %s", s)
+		}
+		name := s[:eq]
+		var value strings.Builder
+		i := eq + 2
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] != '\\' {
+				value.WriteByte(s[i])
+				continue
+			}
+			i++
+			if i >= len(s) {
+				return nil, fmt.Errorf("转义不完整: %s", s)
+			}
+			switch s[i] {
+			case '\\':
+				value.WriteByte('\\')
+			case '"':
+				value.WriteByte('"')
+			case 'n':
+				value.WriteByte('\n')
+			default:
+				return nil, fmt.Errorf("不支持的转义 \\%c", s[i])
+			}
+		}
+		if i >= len(s) {
+			return nil, fmt.Errorf("标签值没有结束: %s", s)
+		}
+		if _, ok := labels[name]; ok {
+			return nil, fmt.Errorf("标签重复: %s", name)
+		}
+		labels[name] = value.String()
+		s = strings.TrimPrefix(s[i+1:], ",")
+	}
+	return labels, nil
+}
+
+// 解析 /metrics 输出，校验每个样本之前都有对应的 HELP 和 TYPE
+func parseExposition(t *testing.T, text string) (map[string]string, map[string]string, []sample) {
+	helps := make(map[string]string)
+	types := make(map[string]string)
+	var samples []sample
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "# HELP ") {
+			parts := strings.SplitN(strings.TrimPrefix(line, "# HELP "), " ", 2)
+			if len(parts) != 2 {
+				t.Fatalf("HELP 格式错误: %q", line)
+			}
+			if _, ok := helps[parts[0]]; ok {
+				t.Fatalf("HELP 重复: %s", parts[0])
+			}
+			helps[parts[0]] = parts[1]
+			continue
+		}
+		if strings.HasPrefix(line, "# TYPE ") {
+			parts := strings.Fields(strings.TrimPrefix(line, "# TYPE "))
+			if len(parts) != 2 {
+				t.Fatalf("TYPE 格式错误: %q", line)
+			}
+			if _, ok := helps[parts[0]]; !ok {
+				t.Fatalf("TYPE 之前没有 HELP: %s", parts[0])
+			}
+			switch parts[1] {
+			case "counter", "gauge", "histogram":
+			default:
+				t.Fatalf("不支持的类型: %q", line)
+			}
+			types[parts[0]] = parts[1]
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			t.Fatalf("未知的注释行: %q", line)
+		}
+		// 标签值中可能包含空格，按最后一个空格分隔数值
+		sp := strings.LastIndex(line, " ")
+		if sp <= 0 {
+			t.Fatalf("样本格式错误: %q", line)
+		}
+		value, err := strconv.ParseFloat(line[sp+1:], 64)
+		if err != nil {
+			t.Fatalf("样本数值错误: %q", line)
+		}
+		name, labelText := line[:sp], ""
+		if i := strings.Index(name, "{"); i >= 0 {
+			name, labelText = name[:i], name[i:]
+			if !strings.HasSuffix(labelText, "}") {
+				t.Fatalf("标签没有结束: %q", line)
+			}
+		}
+		labels, err := parseLabels(labelText)
+		if err != nil {
+			t.Fatalf("%v: %q", err, line)
+		}
+		family := name
+		for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+			if base := strings.TrimSuffix(name, suffix); base != name && types[base] == "histogram" {
+				family = base
+			}
+		}
+		if _, ok := types[family]; !ok {
+			t.Fatalf("样本之前没有 TYPE: %q", line)
+		}
+		samples = append(samples, sample{name: name, labels: labels, value: value})
+	}
+	return helps, types, samples
+}
+
+// 去掉 le 后的标签，用于区分直方图序列
+func seriesKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		if k != "le" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k + "=" + strconv.Quote(labels[k]) + ",")
+	}
+	return b.String()
+}
+
+// 校验直方图：分桶按 le 升序且累计值不减少，最后一个分桶为 +Inf 且等于 _count
+func checkHistogram(t *testing.T, name string, samples []sample) {
+	type bucket struct {
+		le    float64
+		count float64
+	}
+	buckets := make(map[string][]bucket)
+	counts := make(map[string]float64)
+	sums := make(map[string]bool)
+	for _, s := range samples {
+		key := seriesKey(s.labels)
+		switch s.name {
+		case name + "_bucket":
+			le, err := strconv.ParseFloat(s.labels["le"], 64)
+			if err != nil {
+				t.Fatalf("%s le 错误: %q", name, s.labels["le"])
+			}
+			buckets[key] = append(buckets[key], bucket{le, s.value})
+		case name + "_count":
+			counts[key] = s.value
+		case name + "_sum":
+			sums[key] = true
+		}
+	}
+	if len(buckets) == 0 {
+		t.Fatalf("%s 没有分桶", name)
+	}
+	for key, list := range buckets {
+		for i := 1; i < len(list); i++ {
+			if list[i].le <= list[i-1].le {
+				t.Errorf("%s{%s} 分桶没有按 le 升序: %v", name, key, list)
+			}
+			if list[i].count < list[i-1].count {
+				t.Errorf("%s{%s} 分桶累计值减少: %v", name, key, list)
+			}
+		}
+		last := list[len(list)-1]
+		if !math.IsInf(last.le, 1) {
+			t.Errorf("%s{%s} 最后一个分桶不是 +Inf", name, key)
+		}
+		count, ok := counts[key]
+		if !ok || count != last.count {
+			t.Errorf("%s{%s} +Inf 分桶 %v 与 _count %v 不一致", name, key, last.count, count)
+		}
+		if !sums[key] {
+			t.Errorf("%s{%s} 缺少 _sum", name, key)
+		}
+	}
+}
+
+func TestHandlerExposition(t *testing.T) {
+	counter := NewCounterVec("test_escape_total", "Help with \\ backslash\nand newline.", "path", "result")
+	weird := "C:\\dicom\\\"a b\"\nnext"
+	counter.WithLabelValues(weird, ResultSuccess).Add(3)
+	counter.WithLabelValues("plain", ResultFailed).Inc()
+
+	gauge := NewGaugeVec("test_gauge", "Test gauge.")
+	gauge.WithLabelValues().Set(-1.5)
+
+	histogram := NewHistogramVec("test_duration_seconds", "Test histogram.", []float64{1, 0.1, 10}, "stage")
+	for _, v := range []float64{0.05, 0.1, 0.5, 2, 20, 30} {
+		histogram.WithLabelValues("put").Observe(v)
+	}
+	histogram.WithLabelValues("head").Observe(0.01)
+
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := recorder.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	helps, types, samples := parseExposition(t, recorder.Body.String())
+
+	// 每个已注册的指标都有 HELP 和 TYPE
+	for name := range defaultRegistry.names {
+		if _, ok := helps[name]; !ok {
+			t.Errorf("%s 缺少 HELP", name)
+		}
+		if _, ok := types[name]; !ok {
+			t.Errorf("%s 缺少 TYPE", name)
+		}
+	}
+	if helps["test_escape_total"] != `Help with \\ backslash\nand newline.` {
+		t.Errorf("HELP 转义错误: %q", helps["test_escape_total"])
+	}
+	if types["test_escape_total"] != "counter" || types["test_gauge"] != "gauge" || types["test_duration_seconds"] != "histogram" {
+		t.Errorf("TYPE 错误: %v", types)
+	}
+
+	// 标签值转义后能还原
+	values := make(map[string]float64)
+	for _, s := range samples {
+		if s.name == "test_escape_total" {
+			values[s.labels["path"]+"|"+s.labels["result"]] = s.value
+		}
+		if s.name == "test_gauge" && (len(s.labels) != 0 || s.value != -1.5) {
+			t.Errorf("test_gauge = %+v", s)
+		}
+	}
+	if values[weird+"|"+ResultSuccess] != 3 || values["plain|"+ResultFailed] != 1 {
+		t.Errorf("test_escape_total = %v", values)
+	}
+
+	checkHistogram(t, "test_duration_seconds", samples)
+	for _, s := range samples {
+		if s.name == "test_duration_seconds_bucket" && s.labels["stage"] == "put" {
+			// 0.05 0.1 ≤ 0.1，0.5 ≤ 1，2 ≤ 10，20 30 只在 +Inf
+			want := map[string]float64{"0.1": 2, "1": 3, "10": 4, "+Inf": 6}
+			if s.value != want[s.labels["le"]] {
+				t.Errorf("put le=%s = %v, want %v", s.labels["le"], s.value, want[s.labels["le"]])
+			}
+		}
+	}
+	for name, typ := range types {
+		if typ == "histogram" && name != "test_duration_seconds" {
+			for _, s := range samples {
+				if s.name == name+"_bucket" {
+					checkHistogram(t, name, samples)
+					break
+				}
+			}
+		}
+	}
+}
+
+func seriesValue(s *series) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.value
+}
+
+// 连接池关闭的连接数按累计值的差值计数，连接池重新创建后从0开始
+func TestObserveDBStats(t *testing.T) {
+	ObserveDBStats("test", sql.DBStats{OpenConnections: 3, InUse: 1, MaxIdleClosed: 2, MaxLifetimeClosed: 5})
+	ObserveDBStats("test", sql.DBStats{OpenConnections: 2, InUse: 2, MaxIdleClosed: 4, MaxLifetimeClosed: 5})
+	ObserveDBStats("test", sql.DBStats{OpenConnections: 1, MaxIdleClosed: 1, MaxLifetimeClosed: 1})
+
+	if v := seriesValue(DBOpenConnections.WithLabelValues("test").s); v != 1 {
+		t.Errorf("open connections = %v, want 1", v)
+	}
+	if v := seriesValue(DBInUseConnections.WithLabelValues("test").s); v != 0 {
+		t.Errorf("in use connections = %v, want 0", v)
+	}
+	want := map[string]float64{"max_idle": 5, "max_idle_time": 0, "max_lifetime": 6}
+	for reason, n := range want {
+		if v := seriesValue(DBClosedConnections.WithLabelValues("test", reason).s); v != n {
+			t.Errorf("closed connections %s = %v, want %v", reason, v, n)
+		}
+	}
+}
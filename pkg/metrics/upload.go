@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// 上传服务指标
+
+// 上传结果
+const (
+	ResultSuccess       = "success"
+	ResultFailed        = "failed"
+	ResultThrottled     = "throttled"
+	ResultRetry         = "retry"
+	ResultVerifyFailed  = "verify_failed"
+	ResultMissingSource = "missing_source"
+	ResultLostClaim     = "lost_claim"
+)
+
+// 上传阶段
+const (
+	StagePresign           = "presign"
+	StagePut               = "put"
+	StageMultipartInit     = "multipart_init"
+	StageMultipartPart     = "multipart_part"
+	StageMultipartComplete = "multipart_complete"
+	StageHead              = "head"
+)
+
+var (
+	// 上传结果数量，按文件类型、结果区分
+	UploadTotal = NewCounterVec("dicom_upload_total",
+		"Number of finished uploads by file type and result.", "type", "result")
+	// 上传成功的字节数
+	UploadBytes = NewCounterVec("dicom_upload_bytes_total",
+		"Bytes of successfully uploaded objects by file type.", "type")
+	// 各阶段耗时
+	StageDuration = NewHistogramVec("dicom_upload_stage_duration_seconds",
+		"Latency of each upload stage by backend.", DefBuckets, "backend", "stage", "result")
+
+	// 工作池
+	PoolWorkers = NewGaugeVec("dicom_upload_pool_workers",
+		"Number of workers in the worker pool.")
+	PoolBusy = NewGaugeVec("dicom_upload_pool_busy_workers",
+		"Number of workers currently running a job.")
+	PoolQueued = NewGaugeVec("dicom_upload_pool_queued_jobs",
+		"Number of submitted jobs waiting for a worker.")
+	PoolJobs = NewCounterVec("dicom_upload_pool_jobs_total",
+		"Number of jobs finished by the worker pool.")
+	ConcurrencyLimit = NewGaugeVec("dicom_upload_concurrency_limit",
+		"Current adaptive limit of concurrent uploads.")
+
+	// 源文件主机
+	SourceHostReads = NewGaugeVec("dicom_upload_source_host_reads",
+		"Number of files currently being read by source host.", "host")
+
+	// 数据获取
+	DiscoveryBatchSize = NewHistogramVec("dicom_upload_discovery_batch_size",
+		"Number of rows queued per discovery run by file type.",
+		[]float64{0, 1, 10, 50, 100, 200, 500, 1000, 5000}, "type")
+	DiscoveryRuns = NewCounterVec("dicom_upload_discovery_runs_total",
+		"Number of discovery runs by file type.", "type")
+
+	// 失败数据定时重试
+	RetrySweep = NewCounterVec("dicom_upload_retry_sweep_total",
+		"Number of failed uploads requeued or parked by the retry sweep by file type.", "type", "result")
+
+	// 数据库连接
+	DBPing = NewCounterVec("dicom_upload_db_ping_total",
+		"Number of database pings by engine and result.", "db", "result")
+	// 数据库连接池（sql.DB.Stats），无效连接由连接池关闭后重新建立
+	DBOpenConnections = NewGaugeVec("dicom_upload_db_open_connections",
+		"Number of established database connections by engine.", "db")
+	DBInUseConnections = NewGaugeVec("dicom_upload_db_in_use_connections",
+		"Number of database connections currently in use by engine.", "db")
+	DBClosedConnections = NewCounterVec("dicom_upload_db_closed_connections_total",
+		"Number of database connections closed by the pool by engine and reason.", "db", "reason")
+)
+
+// 上次记录的连接池统计，sql.DBStats 中关闭的连接数是累计值，按差值增加计数
+var dbStats = struct {
+	sync.Mutex
+	m map[string]sql.DBStats
+}{m: make(map[string]sql.DBStats)}
+
+// 记录数据库连接池统计，db 为 read/write
+func ObserveDBStats(db string, stats sql.DBStats) {
+	DBOpenConnections.WithLabelValues(db).Set(float64(stats.OpenConnections))
+	DBInUseConnections.WithLabelValues(db).Set(float64(stats.InUse))
+	dbStats.Lock()
+	last := dbStats.m[db]
+	dbStats.m[db] = stats
+	dbStats.Unlock()
+	closed := func(reason string, current, previous int64) {
+		if current < previous {
+			// 连接池已重新创建，累计值从0开始
+			previous = 0
+		}
+		DBClosedConnections.WithLabelValues(db, reason).Add(float64(current - previous))
+	}
+	closed("max_idle", stats.MaxIdleClosed, last.MaxIdleClosed)
+	closed("max_idle_time", stats.MaxIdleTimeClosed, last.MaxIdleTimeClosed)
+	closed("max_lifetime", stats.MaxLifetimeClosed, last.MaxLifetimeClosed)
+}
+
+// 记录阶段耗时，err 为空时 result 为 success
+func ObserveStage(backend, stage string, start time.Time, err error) {
+	result := ResultSuccess
+	if err != nil {
+		result = ResultFailed
+	}
+	StageDuration.WithLabelValues(backend, stage, result).Observe(time.Since(start).Seconds())
+}
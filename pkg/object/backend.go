@@ -0,0 +1,161 @@
+package object
+
+import (
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/global"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 存储后端名称
+const (
+	BackendPlatform  = "platform"  // 通过平台接口转发上传
+	BackendS3Presign = "s3presign" // 通过平台获取S3临时地址直接上传
+)
+
+// 平台接口成功返回码
+const SuccessCode = "00000"
+
+// 平台接口限流返回码
+const ThrottledCode = "A2105"
+
+var ErrNotSupported = errors.New("存储后端不支持该操作")
+
+// 存储后端返回的业务错误，Code 为平台返回码或HTTP状态码
+type BackendError struct {
+	Code       string
+	StatusCode int
+	Msg        string
+	RetryAfter time.Duration // 服务端要求的重试等待时间（Retry-After）
+}
+
+func (e *BackendError) Error() string {
+	return fmt.Sprintf("存储后端返回错误, code: %s, status: %d, msg: %s", e.Code, e.StatusCode, e.Msg)
+}
+
+// 获取错误对应的返回码，成功返回 SuccessCode
+func ErrorCode(err error) string {
+	if err == nil {
+		return SuccessCode
+	}
+	var be *BackendError
+	if errors.As(err, &be) {
+		return be.Code
+	}
+	return err.Error()
+}
+
+// 分段数据
+type Part struct {
+	Number int       // 分段序号，从1开始
+	Offset int64     // 分段在文件中的偏移
+	Size   int64     // 分段大小
+	Last   bool      // 是否最后一段
+	Body   io.Reader // 分段数据
+}
+
+// 远端对象信息
+type ObjectInfo struct {
+	Size int64
+	ETag string
+}
+
+// 存储后端
+// 对象上传流程（UploadObject）只依赖该接口，新增存储目标时实现该接口并通过 RegisterBackend 注册即可
+type Backend interface {
+	Name() string
+	// 单次上传整个对象，返回后端的 ETag（不支持时为空）
+	Put(ctx context.Context, obj *Object, body io.Reader, size int64) (string, error)
+	// 分段上传：初始化、上传分段、完成、取消，不支持时返回 ErrNotSupported
+	InitMultipart(ctx context.Context, obj *Object) (string, error)
+	UploadPart(ctx context.Context, obj *Object, uploadid string, part Part) (global.FileResult, error)
+	CompleteMultipart(ctx context.Context, obj *Object, uploadid string, parts []global.FileResult) error
+	AbortMultipart(ctx context.Context, obj *Object, uploadid string) error
+	// 查询、删除远端对象，不支持时返回 ErrNotSupported
+	Head(ctx context.Context, obj *Object) (*ObjectInfo, error)
+	Delete(ctx context.Context, obj *Object) error
+}
+
+var (
+	backendMu sync.RWMutex
+	factories = make(map[string]func() (Backend, error))
+	current   Backend
+)
+
+// 注册存储后端
+func RegisterBackend(name string, factory func() (Backend, error)) {
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	if _, ok := factories[name]; ok {
+		panic(fmt.Sprintf("存储后端 %s 已经存在", name))
+	}
+	factories[name] = factory
+}
+
+// 已注册的存储后端名称
+func Backends() []string {
+	backendMu.RLock()
+	defer backendMu.RUnlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 按名称创建存储后端
+func NewBackend(name string) (Backend, error) {
+	backendMu.RLock()
+	factory, ok := factories[strings.ToLower(name)]
+	backendMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("未知的存储后端: %s, 可选: %v", name, Backends())
+	}
+	return factory()
+}
+
+// 根据配置初始化当前使用的存储后端
+// OBJECT_Backend 为空时沿用 OBJECT_Interface_Type 的配置
+func SetupBackend() error {
+	if err := SetupHTTPClient(); err != nil {
+		return err
+	}
+	name := global.ObjectSetting.OBJECT_Backend
+	if name == "" {
+		name = BackendPlatform
+		if global.ObjectSetting.OBJECT_Interface_Type == global.Interfacce_Type_S3 {
+			name = BackendS3Presign
+		}
+	}
+	backend, err := NewBackend(name)
+	if err != nil {
+		return err
+	}
+	backendMu.Lock()
+	current = backend
+	backendMu.Unlock()
+	return nil
+}
+
+// 当前使用的存储后端
+func CurrentBackend() Backend {
+	backendMu.RLock()
+	defer backendMu.RUnlock()
+	return current
+}
+
+// 拼接对象操作地址：base//resId//fileKey
+func objectURL(base string, obj *Object) string {
+	url := base
+	url += "//"
+	url += global.ObjectSetting.OBJECT_ResId
+	url += "//"
+	url += obj.FileKey
+	return url
+}
@@ -0,0 +1,179 @@
+package object
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrChecksumMismatch = errors.New("上传对象校验和不一致")
+	ErrVerifyFailed     = errors.New("远端对象校验失败")
+)
+
+// 文件校验和（十六进制）
+// 分段上传的对象：MD5 为组合MD5（与S3分段ETag相同），SHA256 为按分段顺序串联计算的整个文件SHA-256（无法按顺序计算时为空），
+// PartSHA256 为各分段SHA-256拼接后的SHA-256加 -分段数，PartSize 为分段大小
+type Checksum struct {
+	MD5        string
+	SHA256     string
+	PartSHA256 string `json:",omitempty"`
+	PartSize   int64  `json:",omitempty"`
+}
+
+// 读取数据的同时计算 MD5 和 SHA-256，上传完成后与后端返回的 ETag 比较（不预先读取源文件计算 Content-MD5，源文件只读取一次）
+type hashReader struct {
+	r      io.Reader
+	md5    hash.Hash
+	sha256 hash.Hash
+	chain  *chainHash // 按顺序读取的分段同时计算整个文件的SHA-256
+}
+
+func newHashReader(r io.Reader) *hashReader {
+	return &hashReader{
+		r:      r,
+		md5:    md5.New(),
+		sha256: sha256.New(),
+	}
+}
+
+func (h *hashReader) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	if n > 0 {
+		h.md5.Write(p[:n])
+		h.sha256.Write(p[:n])
+		if h.chain != nil {
+			h.chain.h.Write(p[:n])
+		}
+	}
+	return n, err
+}
+
+func (h *hashReader) Sum() Checksum {
+	return Checksum{
+		MD5:    hex.EncodeToString(h.md5.Sum(nil)),
+		SHA256: hex.EncodeToString(h.sha256.Sum(nil)),
+	}
+}
+
+// 分段上传对象的组合校验和：按分段顺序拼接各分段的摘要后再计算摘要，加上 -分段数 后缀
+// （组合MD5与S3分段上传对象的ETag算法相同），分段并发上传时不需要重新读取整个文件
+func compositeChecksum(sums []Checksum) Checksum {
+	if len(sums) == 0 {
+		return Checksum{}
+	}
+	md5sum, sha256sum := md5.New(), sha256.New()
+	for _, sum := range sums {
+		b, err := hex.DecodeString(sum.MD5)
+		if err != nil {
+			return Checksum{}
+		}
+		md5sum.Write(b)
+		if b, err = hex.DecodeString(sum.SHA256); err != nil {
+			return Checksum{}
+		}
+		sha256sum.Write(b)
+	}
+	suffix := "-" + strconv.Itoa(len(sums))
+	return Checksum{
+		MD5:        hex.EncodeToString(md5sum.Sum(nil)) + suffix,
+		PartSHA256: hex.EncodeToString(sha256sum.Sum(nil)) + suffix,
+	}
+}
+
+// 按分段顺序串联计算整个文件的SHA-256
+// 只有前面的分段都已计算完成时，下一个分段才能在上传时同时计算（串行上传或续传时按顺序进行），
+// 已计算的状态保存在断点记录中，续传时继续计算；分段并发读取时无法按顺序计算，不再重新读取文件
+type chainHash struct {
+	mu       sync.Mutex
+	h        hash.Hash
+	next     int    // 下一个需要计算的分段
+	active   bool   // 是否有分段正在计算
+	snapshot []byte // 当前分段开始计算前的状态，分段失败时恢复
+}
+
+// 从断点记录中保存的状态继续计算
+func newChainHash(state []byte, hashed int) *chainHash {
+	c := &chainHash{h: sha256.New(), next: 1}
+	if hashed > 0 {
+		if err := c.h.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+			// 无法恢复时不再计算
+			c.next = -1
+			return c
+		}
+		c.next = hashed + 1
+	}
+	return c
+}
+
+// 分段开始读取前调用，轮到该分段且没有其他分段正在计算时返回true
+func (c *chainHash) claim(part int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.active || c.next != part {
+		return false
+	}
+	state, err := c.h.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return false
+	}
+	c.active = true
+	c.snapshot = state
+	return true
+}
+
+// 恢复到当前分段开始计算前的状态
+func (c *chainHash) restore() {
+	c.h.(encoding.BinaryUnmarshaler).UnmarshalBinary(c.snapshot)
+}
+
+// 已计算的分段结束，成功时返回计算后的状态，供保存到断点记录
+func (c *chainHash) done(success bool) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.active = false
+	if !success {
+		c.restore()
+		return nil
+	}
+	c.next++
+	state, _ := c.h.(encoding.BinaryMarshaler).MarshalBinary()
+	return state
+}
+
+// 所有分段都已按顺序计算时返回整个文件的SHA-256，否则为空
+func (c *chainHash) sum(parts int) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.next != parts+1 {
+		return ""
+	}
+	return hex.EncodeToString(c.h.Sum(nil))
+}
+
+// 比较后端返回的 ETag 与本地 MD5
+// 本地为分段组合校验和（带-N后缀）时与分段ETag比较，否则只有 ETag 是单个对象的 MD5（32位十六进制）时才能比较，
+// 其他ETag（如加密对象的ETag）视为无法比较
+func etagMatches(etag string, md5hex string) bool {
+	etag = strings.ToLower(strings.Trim(strings.TrimSpace(etag), `"`))
+	if strings.Contains(md5hex, "-") {
+		if !strings.Contains(etag, "-") {
+			return true
+		}
+		return etag == md5hex
+	}
+	if len(etag) != md5.Size*2 {
+		return true
+	}
+	if _, err := hex.DecodeString(etag); err != nil {
+		return true
+	}
+	return etag == md5hex
+}
@@ -0,0 +1,80 @@
+package object
+
+import (
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/global"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// 所有存储后端共用的HTTP客户端
+// 连接复用，同一主机的多个文件/分段不再每次重新建立TCP+TLS连接；请求超时由调用方的 context 控制
+var (
+	clientMu     sync.RWMutex
+	sharedClient = http.DefaultClient
+)
+
+// 按配置初始化共用的HTTP客户端
+func SetupHTTPClient() error {
+	transport, err := newTransport()
+	if err != nil {
+		return err
+	}
+	clientMu.Lock()
+	defer clientMu.Unlock()
+	sharedClient = &http.Client{Transport: transport}
+	return nil
+}
+
+func httpClient() *http.Client {
+	clientMu.RLock()
+	defer clientMu.RUnlock()
+	return sharedClient
+}
+
+func newTransport() (*http.Transport, error) {
+	setting := global.ObjectSetting
+	proxy := http.ProxyFromEnvironment
+	if setting.HTTP_Proxy != "" {
+		proxyURL, err := url.Parse(setting.HTTP_Proxy)
+		if err != nil {
+			return nil, err
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+	tlsConfig, err := newTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{
+		Timeout:   seconds(setting.HTTP_Connect_Timeout, 20),
+		KeepAlive: seconds(setting.HTTP_Keep_Alive, 30),
+	}
+	return &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          positive(setting.HTTP_Max_Idle_Conns, 100),
+		MaxIdleConnsPerHost:   positive(setting.HTTP_Max_Idle_Conns_Per_Host, 100),
+		MaxConnsPerHost:       setting.HTTP_Max_Conns_Per_Host,
+		IdleConnTimeout:       seconds(setting.HTTP_Idle_Conn_Timeout, 90),
+		DisableKeepAlives:     setting.HTTP_Disable_Keep_Alives,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   seconds(setting.HTTP_TLS_Handshake_Timeout, 10),
+		ResponseHeaderTimeout: time.Duration(setting.HTTP_Response_Header_Timeout) * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}, nil
+}
+
+// 配置值小于等于0时使用默认值
+func positive(value, def int) int {
+	if value <= 0 {
+		return def
+	}
+	return value
+}
+
+func seconds(value, def int) time.Duration {
+	return time.Duration(positive(value, def)) * time.Second
+}
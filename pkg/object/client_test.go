@@ -0,0 +1,71 @@
+package object
+
+import (
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/global"
+	"context"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// 通过HTTPS上传文件，按配置创建HTTP客户端，统计服务端新建的连接数
+func benchmarkUpload(b *testing.B, disableKeepAlives bool) {
+	fake := newFakeS3(false)
+	var conns int64
+	srv := httptest.NewUnstartedServer(fake)
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(&conns, 1)
+		}
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	// 信任测试服务的证书
+	caFile := filepath.Join(b.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0644); err != nil {
+		b.Fatal(err)
+	}
+	old := global.ObjectSetting
+	defer func() { global.ObjectSetting = old }()
+	setting := *old
+	setting.TLS_CA_File = caFile
+	setting.HTTP_Disable_Keep_Alives = disableKeepAlives
+	global.ObjectSetting = &setting
+
+	transport, err := newTransport()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer transport.CloseIdleConnections()
+	backend := newTestS3Backend(b, srv, fake)
+	backend.client = &http.Client{Transport: transport}
+
+	path, data := writeTestFile(b, 64<<10)
+	obj := &Object{Key: 1, FileKey: "2026/1.dcm", FilePath: path}
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := UploadFile(context.Background(), backend, obj); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(atomic.LoadInt64(&conns))/float64(b.N), "conns/op")
+}
+
+// 连接复用（默认配置）
+func BenchmarkUploadReusedConnections(b *testing.B) {
+	benchmarkUpload(b, false)
+}
+
+// 每次请求新建TCP+TLS连接（HTTP_Disable_Keep_Alives）
+func BenchmarkUploadFreshConnections(b *testing.B) {
+	benchmarkUpload(b, true)
+}
@@ -0,0 +1,57 @@
+package object
+
+import (
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/internal/model"
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/errcode"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// 失败原因对应的错误码，保存到上传失败记录中
+// 存储后端返回的错误码优先，没有错误码时使用HTTP状态码，其他错误按原始错误类型归类，无法归类时使用 errcode 错误码
+func failureCode(err error) string {
+	var be *BackendError
+	if errors.As(err, &be) {
+		if be.Code != "" {
+			return be.Code
+		}
+		return "HTTP_" + strconv.Itoa(be.StatusCode)
+	}
+	var ne net.Error
+	switch {
+	case errors.Is(err, ErrChecksumMismatch):
+		return "CHECKSUM_MISMATCH"
+	case errors.Is(err, ErrVerifyFailed):
+		return "VERIFY_FAILED"
+	case errors.Is(err, os.ErrNotExist):
+		return "SOURCE_NOT_FOUND"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "TIMEOUT"
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.As(err, &ne):
+		return "NETWORK"
+	}
+	var ee *errcode.Error
+	if errors.As(err, &ee) {
+		return strconv.Itoa(ee.Code())
+	}
+	return "ERROR"
+}
+
+// 保存上传失败记录
+func recordFailure(backend Backend, obj *Object, err error) {
+	model.RecordFailure(context.Background(), obj.Key, obj.Type, backend.Name(), failureCode(err), failureMessage(err))
+}
+
+// 失败信息，errcode 错误附带详细信息（Error() 不包含详细信息）
+func failureMessage(err error) string {
+	var ee *errcode.Error
+	if errors.As(err, &ee) && len(ee.Details()) > 0 {
+		return err.Error() + ", 详细信息：" + strings.Join(ee.Details(), "; ")
+	}
+	return err.Error()
+}
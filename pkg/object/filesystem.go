@@ -0,0 +1,118 @@
+package object
+
+import (
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/global"
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/general"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const BackendFilesystem = "fs"
+
+func init() {
+	RegisterBackend(BackendFilesystem, func() (Backend, error) {
+		return newFilesystemBackend()
+	})
+}
+
+// 本地文件系统/NAS挂载目录存储
+// 对象按 FS_Root/UPLOAD_ROOT/file_name 保存，与云端key布局一致
+type filesystemBackend struct {
+	root string
+}
+
+func newFilesystemBackend() (*filesystemBackend, error) {
+	root := global.ObjectSetting.FS_Root
+	if root == "" {
+		return nil, errors.New("FS_Root 不能为空")
+	}
+	fileInfo, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !fileInfo.IsDir() {
+		return nil, errors.New("FS_Root 不是目录: " + root)
+	}
+	return &filesystemBackend{root: root}, nil
+}
+
+func (b *filesystemBackend) Name() string {
+	return BackendFilesystem
+}
+
+// 对象在存储目录下的路径，key 不允许跳出根目录
+func (b *filesystemBackend) path(obj *Object) (string, error) {
+	key := filepath.FromSlash(strings.TrimPrefix(obj.FileKey, "/"))
+	path := filepath.Join(b.root, key)
+	rel, err := filepath.Rel(b.root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errors.New("非法的对象key: " + obj.FileKey)
+	}
+	return path, nil
+}
+
+// 写入临时文件、fsync、校验大小和sha256后重命名为目标文件
+func (b *filesystemBackend) Put(ctx context.Context, obj *Object, body io.Reader, size int64) (string, error) {
+	path, err := b.path(obj)
+	if err != nil {
+		return "", err
+	}
+	// 本地写入不支持 context，超时或取消后停止读取数据，写入失败后删除临时文件
+	checksum, err := general.WriteFileAtomic(path, ctxReader{ctx: ctx, r: body}, size)
+	if err != nil {
+		global.Logger.Error("写入存储目录失败: ", path, " err: ", err)
+		return "", err
+	}
+	global.Logger.Debug("写入存储目录成功: ", path, " sha256: ", checksum)
+	return "", nil
+}
+
+// 本地存储直接整体写入，不需要分段上传
+func (b *filesystemBackend) InitMultipart(ctx context.Context, obj *Object) (string, error) {
+	return "", ErrNotSupported
+}
+
+func (b *filesystemBackend) UploadPart(ctx context.Context, obj *Object, uploadid string, part Part) (global.FileResult, error) {
+	return global.FileResult{}, ErrNotSupported
+}
+
+func (b *filesystemBackend) CompleteMultipart(ctx context.Context, obj *Object, uploadid string, parts []global.FileResult) error {
+	return ErrNotSupported
+}
+
+func (b *filesystemBackend) AbortMultipart(ctx context.Context, obj *Object, uploadid string) error {
+	return ErrNotSupported
+}
+
+func (b *filesystemBackend) Head(ctx context.Context, obj *Object) (*ObjectInfo, error) {
+	path, err := b.path(obj)
+	if err != nil {
+		return nil, err
+	}
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, &BackendError{Code: strconv.Itoa(http.StatusNotFound), StatusCode: http.StatusNotFound, Msg: err.Error()}
+		}
+		return nil, err
+	}
+	return &ObjectInfo{Size: fileInfo.Size()}, nil
+}
+
+func (b *filesystemBackend) Delete(ctx context.Context, obj *Object) error {
+	path, err := b.path(obj)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package object
+
+import (
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/global"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 分段上传断点记录
+// 每个 instance_key + 文件类型 对应 Multipart_Journal_Dir 下的一个json文件，
+// 记录 uploadId、源文件大小/修改时间以及已完成分段的 etag 和校验和，服务重启后据此续传剩余分段
+type uploadJournal struct {
+	InstanceKey int64                     `json:"instanceKey"`
+	Type        global.FileType           `json:"type"`
+	FileKey     string                    `json:"fileKey"`
+	FilePath    string                    `json:"filePath"`
+	UploadId    string                    `json:"uploadId"`
+	FileSize    int64                     `json:"fileSize"`
+	ModTime     int64                     `json:"modTime"`
+	PartSize    int64                     `json:"partSize"`
+	CreateTime  int64                     `json:"createTime"`
+	Parts       map[int]global.FileResult `json:"parts"`
+	Sums        map[int]Checksum          `json:"sums"`        // 已完成分段的校验和，用于计算整个对象的组合校验和
+	HashState   []byte                    `json:"hashState"`   // 按顺序计算整个文件SHA-256的中间状态
+	HashedParts int                       `json:"hashedParts"` // 已按顺序计算SHA-256的分段数
+
+	mu sync.Mutex
+}
+
+func journalPath(key int64, filetype global.FileType) string {
+	name := fmt.Sprintf("%d_%d.json", key, filetype)
+	return filepath.Join(global.ObjectSetting.Multipart_Journal_Dir, name)
+}
+
+// 读取断点记录，不存在或无法解析时返回nil
+func loadJournal(obj *Object) *uploadJournal {
+	content, err := os.ReadFile(journalPath(obj.Key, obj.Type))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			global.Logger.Error("读取分段上传断点记录失败: ", obj.Key, err)
+		}
+		return nil
+	}
+	j := &uploadJournal{}
+	if err = json.Unmarshal(content, j); err != nil {
+		global.Logger.Error("解析分段上传断点记录失败: ", obj.Key, err)
+		return nil
+	}
+	if j.Parts == nil {
+		j.Parts = make(map[int]global.FileResult)
+	}
+	if j.Sums == nil {
+		j.Sums = make(map[int]Checksum)
+	}
+	return j
+}
+
+func newJournal(obj *Object, uploadid string, fileInfo os.FileInfo, partSize int64) *uploadJournal {
+	return &uploadJournal{
+		InstanceKey: obj.Key,
+		Type:        obj.Type,
+		FileKey:     obj.FileKey,
+		FilePath:    obj.FilePath,
+		UploadId:    uploadid,
+		FileSize:    fileInfo.Size(),
+		ModTime:     fileInfo.ModTime().UnixNano(),
+		PartSize:    partSize,
+		CreateTime:  time.Now().Unix(),
+		Parts:       make(map[int]global.FileResult),
+		Sums:        make(map[int]Checksum),
+	}
+}
+
+// 判断断点记录是否仍然可以续传：源文件未变化、分段大小一致且未过期
+func (j *uploadJournal) resumable(obj *Object, fileInfo os.FileInfo, partSize int64) bool {
+	if j.UploadId == "" || j.FileKey != obj.FileKey || j.PartSize != partSize {
+		return false
+	}
+	if j.FileSize != fileInfo.Size() || j.ModTime != fileInfo.ModTime().UnixNano() {
+		return false
+	}
+	// 缺少分段校验和时无法计算组合校验和
+	if len(j.Sums) != len(j.Parts) {
+		return false
+	}
+	if expire := global.ObjectSetting.Multipart_Journal_Expire; expire > 0 {
+		if time.Since(time.Unix(j.CreateTime, 0)) > time.Duration(expire)*time.Hour {
+			return false
+		}
+	}
+	return true
+}
+
+// 已完成的分段
+func (j *uploadJournal) done(partNumber int) (global.FileResult, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	result, ok := j.Parts[partNumber]
+	return result, ok
+}
+
+// 记录完成的分段及其校验和并落盘，state 不为空时同时保存按顺序计算SHA-256的状态
+func (j *uploadJournal) addPart(result global.FileResult, sum Checksum, state []byte) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.Parts[result.PartNumber] = result
+	j.Sums[result.PartNumber] = sum
+	if state != nil {
+		j.HashState = state
+		j.HashedParts = result.PartNumber
+	}
+	if err := j.save(); err != nil {
+		global.Logger.Error("保存分段上传断点记录失败: ", j.InstanceKey, err)
+	}
+}
+
+// 已完成分段的有序列表
+func (j *uploadJournal) partList() []global.FileResult {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	list := make([]global.FileResult, 0, len(j.Parts))
+	for _, v := range j.Parts {
+		list = append(list, v)
+	}
+	sort.Slice(list, func(a, b int) bool {
+		return list[a].PartNumber < list[b].PartNumber
+	})
+	return list
+}
+
+// 按分段顺序计算整个对象的组合校验和，所有分段都已按顺序计算SHA-256时同时返回整个文件的SHA-256
+func (j *uploadJournal) checksum() Checksum {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	sums := make([]Checksum, 0, len(j.Sums))
+	for i := 1; i <= len(j.Sums); i++ {
+		sum, ok := j.Sums[i]
+		if !ok {
+			return Checksum{}
+		}
+		sums = append(sums, sum)
+	}
+	sum := compositeChecksum(sums)
+	sum.PartSize = j.PartSize
+	if len(sums) > 0 && j.HashedParts == len(sums) {
+		chain := newChainHash(j.HashState, j.HashedParts)
+		sum.SHA256 = chain.sum(len(sums))
+	}
+	return sum
+}
+
+// 写入临时文件后重命名，避免进程中断时留下不完整的记录
+func (j *uploadJournal) save() error {
+	if err := os.MkdirAll(global.ObjectSetting.Multipart_Journal_Dir, os.ModePerm); err != nil {
+		return err
+	}
+	content, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	path := journalPath(j.InstanceKey, j.Type)
+	temp := path + ".tmp"
+	if err = os.WriteFile(temp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(temp, path)
+}
+
+func (j *uploadJournal) saveLocked() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.save()
+}
+
+func removeJournal(obj *Object) {
+	err := os.Remove(journalPath(obj.Key, obj.Type))
+	if err != nil && !os.IsNotExist(err) {
+		global.Logger.Error("删除分段上传断点记录失败: ", obj.Key, err)
+	}
+}
@@ -0,0 +1,29 @@
+package object
+
+import (
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/global"
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/logger"
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/setting"
+	"io"
+	"log"
+	"os"
+	"testing"
+)
+
+// 测试使用的全局配置，日志不输出
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "object-test-*")
+	if err != nil {
+		panic(err)
+	}
+	global.Logger = logger.NewLogger(io.Discard, "", log.LstdFlags)
+	global.ObjectSetting = &setting.ObjectSettingS{
+		Each_Section_Size:      5,
+		Multipart_Concurrency:  4,
+		Multipart_Journal_Dir:  dir,
+		OBJECT_Checksum_Verify: true,
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
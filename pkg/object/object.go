@@ -3,17 +3,17 @@ package object
 import (
 	"WowjoyProject/ObjectCloudService_Upload_Dicom/global"
 	"WowjoyProject/ObjectCloudService_Upload_Dicom/internal/model"
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/bandwidth"
 	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/errcode"
 	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/general"
-	"bytes"
-	"crypto/tls"
-	"encoding/json"
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/metrics"
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"mime/multipart"
-	"net"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 )
 
@@ -26,6 +26,9 @@ type Object struct {
 	FilePath string          // 文件路径
 	Type     global.FileType // 文件类型
 	Count    int             // 文件执行次数
+	Size     int64           // 上传内容大小
+	Checksum Checksum        // 上传内容的校验和
+	source   *sourceHost     // 源文件所在主机的读取限制
 }
 
 func NewObject(data global.ObjectData) *Object {
@@ -39,304 +42,355 @@ func NewObject(data global.ObjectData) *Object {
 }
 
 // 上传对象[POST]
-func (obj *Object) UploadObject() {
+// ctx 取消（停止服务）时中断上传，各次请求的超时按文件大小另行设置
+func (obj *Object) UploadObject(ctx context.Context) {
 	// 获取上传对象详细信息
 	global.Logger.Info("开始上传对象：", *obj)
-	var code string
+	backend := CurrentBackend()
+	global.Logger.Info("***通过存储后端上传数据***: ", backend.Name())
+
+	// 打开源文件前获取所在主机的读取许可，同一主机同时读取的文件数不超过配置的上限
+	source, err := acquireSource(ctx, obj.FilePath)
+	if err != nil {
+		global.Logger.Info("停止服务，上传任务中断: ", obj.Key, " err: ", err)
+		return
+	}
+	defer source.release()
+	obj.source = source
+	if _, err = os.Stat(obj.FilePath); os.IsNotExist(err) {
+		if rerr := sourceReachable(obj.FilePath); rerr != nil {
+			// 源文件所在主机或共享目录无法访问，恢复后可以重新上传，按上传失败处理
+			global.Logger.Error("源文件所在主机无法访问: ", obj.Key, " ", obj.FilePath, " err: ", rerr)
+			recordFailure(backend, obj, errcode.File_OpenError.Wrap(rerr))
+			metrics.UploadTotal.WithLabelValues(obj.Type.String(), metrics.ResultFailed).Inc()
+			model.UpdateUplaod(context.Background(), obj.Key, obj.Type, obj.FileKey, "", "", 0, false)
+			return
+		}
+		// 源文件不存在，重试也不会成功
+		global.Logger.Error("源文件不存在: ", obj.Key, " ", obj.FilePath)
+		recordFailure(backend, obj, err)
+		metrics.UploadTotal.WithLabelValues(obj.Type.String(), metrics.ResultMissingSource).Inc()
+		model.UpdateRemoteStatus(context.Background(), obj.Key, obj.Type, model.StatusMissingSource)
+		return
+	}
 
-	// 增加上传模式，是通过平台上传还是临时地址上传
-	if global.ObjectSetting.OBJECT_Interface_Type == global.Interfacce_Type_S3 {
-		global.Logger.Info("***通过S3接口上传数据***")
-		code = S3UploadFile(obj)
+	start := time.Now()
+	// 判断文件大小，来区别是否开始分段上传
+	fileSize := general.GetFileSize(obj.FilePath)
+	if fileSize >= (int64(global.ObjectSetting.File_Fragment_Size << 20)) {
+		// 大文件上传
+		err = UploadLargeFile(ctx, backend, obj, fileSize)
+		if errors.Is(err, ErrNotSupported) {
+			// 存储后端不支持分段上传，整体上传
+			err = UploadFile(ctx, backend, obj)
+		}
 	} else {
-		global.Logger.Info("***通过平台接口转发上传数据***")
-		// 判断文件大小，来区别是否开始分段上传
-		fileSize := general.GetFileSize(obj.FilePath)
-		if fileSize >= (int64(global.ObjectSetting.File_Fragment_Size << 20)) {
-			// 大文件上传
-			code = UploadLargeFile(obj, fileSize)
-		} else {
-			// 小文件上传
-			code = UploadFile(obj)
+		// 小文件上传
+		err = UploadFile(ctx, backend, obj)
+	}
+	// 上传结果必须写入数据库，不随任务取消
+	dbctx := context.Background()
+	if err == nil && global.ObjectSetting.OBJECT_Verify_Remote {
+		// 上传成功后查询远端对象，确认对象确实存在且内容一致
+		verr := VerifyRemote(ctx, backend, obj)
+		if errors.Is(verr, ErrVerifyFailed) {
+			global.Logger.Error("远端对象校验失败: ", obj.Key, " err: ", verr)
+			recordFailure(backend, obj, verr)
+			metrics.UploadTotal.WithLabelValues(obj.Type.String(), metrics.ResultVerifyFailed).Inc()
+			model.UpdateRemoteStatus(dbctx, obj.Key, obj.Type, model.StatusVerifyFailed)
+			return
+		}
+		if verr != nil {
+			// 查询失败（网络错误、超时等）无法确认远端对象，上传结果仍按成功处理
+			global.Logger.Warn("远端对象未校验, 按上传成功处理: ", obj.Key, " err: ", verr)
 		}
 	}
-	if code == "00000" {
+	if err != nil && ctx.Err() != nil {
+		// 停止服务中断的任务不更新状态，重启后重新获取
+		global.Logger.Info("停止服务，上传任务中断: ", obj.Key, " err: ", err)
+		return
+	}
+	report(obj, start, err)
+	if err == nil {
 		//上传成功更新数据库
 		global.Logger.Info("数据上传成功: ", obj.Key)
-		model.UpdateUplaod(obj.Key, obj.Type, obj.FileKey, true)
-	} else if code == "A2105" {
-		global.Logger.Info("请求限流，重新放入任务队列", obj.Key)
-		data := global.ObjectData{
-			InstanceKey: obj.Key,
-			FileKey:     obj.FileKey,
-			FilePath:    obj.FilePath,
-			Type:        obj.Type,
-			Count:       1,
+		if !model.UpdateUplaod(dbctx, obj.Key, obj.Type, obj.FileKey, obj.Checksum.SHA256, obj.Checksum.PartSHA256, obj.Checksum.PartSize, true) {
+			// 认领已失效，数据由其他实例处理，不记录为上传成功
+			global.Logger.Warn("认领已失效，不记录上传结果: ", obj.Key)
+			metrics.UploadTotal.WithLabelValues(obj.Type.String(), metrics.ResultLostClaim).Inc()
+			return
 		}
-		global.ObjectDataChan <- data
-	} else {
-		global.Logger.Error("数据上传失败: ", obj.Key)
-		model.UpdateUplaod(obj.Key, obj.Type, obj.FileKey, false)
-	}
-}
-
-// S3接口直接上传数据
-func S3UploadFile(obj *Object) string {
-	// 1.获取临时上传地址
-	global.Logger.Debug("开始获取临时地址")
-	url := global.ObjectSetting.OBJECT_Temp_GET_Upload
-	url += "//"
-	url += global.ObjectSetting.OBJECT_ResId
-	url += "//"
-	url += obj.FileKey
-	global.Logger.Debug("操作的URL: ", url)
-	err, s3url := GetS3URL(url)
-	if err != nil {
-		global.Logger.Error("获取S3临时上传地址错误", err)
-		return err.Error()
-	}
-	// 2.通过临时上传地址上传数据
-	global.Logger.Debug("开始通过临时地址上传：", s3url)
-	return Upload_S3(s3url, obj)
-}
-
-// 获取S3临时上传地址
-func GetS3URL(url string) (error, string) {
-	req, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		global.Logger.Error("http.NewRequest err", err)
-		return err, ""
-	}
-	// 设置AK
-	req.Header.Set("accessKey", global.ObjectSetting.OBJECT_AK)
-	req.Header.Set("Connection", "close")
-	connectTimeout := 20 * time.Second
-	readWriteTimeout := 20 * time.Second
-
-	// 设置参数
-	q := req.URL.Query()
-	q.Add("expireTime", "60000")
-	req.URL.RawQuery = q.Encode()
-	transport := http.Transport{
-		DisableKeepAlives: true,
-		Dial:              TimeoutDialer(connectTimeout, readWriteTimeout),
-		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
-	}
-	client := &http.Client{
-		Transport: &transport,
-	}
-	resp, err := client.Do(req)
-	if err != nil {
-		global.Logger.Error("client.do err", err)
-		return err, ""
-	}
-	defer resp.Body.Close()
-
-	code := resp.StatusCode
-	if code != 200 {
-		global.Logger.Error("获取临时地址失败:", resp.StatusCode)
-		return errcode.Http_RespError, ""
-	}
-	content, err := io.ReadAll(resp.Body)
-	if err != nil {
-		global.Logger.Error("ioutil.ReadAll err: ", err)
-		return errcode.Http_RespError, ""
-	}
-	global.Logger.Info("resp.Body: ", string(content))
-	var result = make(map[string]interface{})
-	err = json.Unmarshal(content, &result)
-	if err != nil {
-		global.Logger.Error("resp.Body: ", "错误")
-		return errcode.Http_RespError, ""
-	}
-	// 解析json
-	if UrlData, ok := result["data"]; ok {
-		resultUrl := UrlData.(string)
-		global.Logger.Info("resultUrl: ", resultUrl)
-		return nil, resultUrl
+		metrics.UploadTotal.WithLabelValues(obj.Type.String(), metrics.ResultSuccess).Inc()
+		metrics.UploadBytes.WithLabelValues(obj.Type.String()).Add(float64(obj.Size))
+		return
+	}
+	// 每次失败都保存失败原因，日志过期后仍可查询
+	recordFailure(backend, obj, err)
+	// 限流和临时错误延迟后重试，超过补偿次数或不可重试的错误更新为上传失败
+	class := classifyError(err)
+	if class != errPermanent {
+		delay := retryDelay(obj.Count, err)
+		if ReDo(ctx, obj, delay) {
+			global.Logger.Info("上传失败(", class, ")，", delay, " 后重试: ", obj.Key, " 第", obj.Count, "次, err: ", err)
+			result := metrics.ResultRetry
+			if class == errThrottled {
+				result = metrics.ResultThrottled
+			}
+			metrics.UploadTotal.WithLabelValues(obj.Type.String(), result).Inc()
+			return
+		}
+		global.Logger.Error("超过补偿次数: ", obj.Key, " 次数: ", obj.Count)
 	}
-	return errcode.Http_RespError, ""
+	global.Logger.Error("数据上传失败: ", obj.Key, " err: ", err)
+	metrics.UploadTotal.WithLabelValues(obj.Type.String(), metrics.ResultFailed).Inc()
+	model.UpdateUplaod(dbctx, obj.Key, obj.Type, obj.FileKey, "", "", 0, false)
 }
 
-// S3上传数据
-func Upload_S3(url string, obj *Object) string {
-	fileSize := general.GetFileSize(obj.FilePath)
-
+// UploadFile 整体上传文件
+// 上传的同时计算 MD5/SHA-256，后端返回的 ETag 与 MD5 不一致时视为上传失败
+func UploadFile(ctx context.Context, backend Backend, obj *Object) error {
 	file, err := os.Open(obj.FilePath)
 	if err != nil {
 		global.Logger.Error("Open File err :", err)
-		return errcode.File_OpenError.Msg()
+		return errcode.File_OpenError.Wrap(err)
 	}
 	defer file.Close()
-	body := &bytes.Buffer{}
-	if fileSize >= (int64(global.ObjectSetting.File_Fragment_Size << 20)) {
-		// 大文件分块读取
-		buff := make([]byte, 1024)
-		for {
-			n, err := file.Read(buff)
-			// 控制条件，根据实际调整
-			if err != nil && err != io.EOF {
-				global.Logger.Error(err)
-				return ""
-			}
-			if n == 0 {
-				break
-			}
-			body.Write(buff[:n])
-		}
-	} else {
-		// 小文件直接读取
-		body.ReadFrom(file)
-	}
-
-	global.Logger.Info("http.NewRequest 开始请求上传文件", obj.Key)
-	req, err := http.NewRequest(http.MethodPut, url, body)
+	fileInfo, err := file.Stat()
 	if err != nil {
-		global.Logger.Error("http.NewRequest err", err)
-		return err.Error()
+		global.Logger.Error("File Stat err :", err)
+		return errcode.File_OpenError.Wrap(err)
 	}
-	req.Header.Set("Content-Type", "application/octet-stream")
-	req.Header.Set("Connection", "close")
-
-	transport := http.Transport{
-		DisableKeepAlives: true,
-		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
-	}
-	client := &http.Client{
-		Transport: &transport,
-	}
-	resp, err := client.Do(req)
+	start := time.Now()
+	putCtx, cancel := context.WithTimeout(ctx, transferTimeout(fileInfo.Size()))
+	defer cancel()
+	body := newHashReader(obj.source.reader(putCtx, file))
+	etag, err := backend.Put(putCtx, obj, bandwidth.NewReader(putCtx, body, bandwidth.Default), fileInfo.Size())
+	metrics.ObserveStage(backend.Name(), metrics.StagePut, start, err)
 	if err != nil {
-		global.Logger.Error("client.do err", err)
-		return ""
+		return err
 	}
-	defer resp.Body.Close()
-
-	code := resp.StatusCode
-	global.Logger.Debug("S3上传数据 resp.StatusCode:", resp.StatusCode)
-	if code == 200 {
-		return "00000"
+	obj.Size = fileInfo.Size()
+	obj.Checksum = body.Sum()
+	if global.ObjectSetting.OBJECT_Checksum_Verify && !etagMatches(etag, obj.Checksum.MD5) {
+		global.Logger.Error("上传对象ETag与本地MD5不一致: ", obj.Key, " etag: ", etag, " md5: ", obj.Checksum.MD5)
+		return ErrChecksumMismatch
 	}
-	return ""
+	return nil
 }
 
-// UploadFile 上传文件
-func UploadFile(obj *Object) string {
-	global.Logger.Debug("开始执行文件上传")
-	url := global.ObjectSetting.OBJECT_POST_Upload
-	url += "//"
-	url += global.ObjectSetting.OBJECT_ResId
-	url += "//"
-	url += obj.FileKey
-	global.Logger.Debug("操作的URL: ", url)
+// // UploadLargeFile 上传大文件
+// 存在有效的断点记录时沿用原 uploadId 续传剩余分段，源文件发生变化时取消原上传后重新开始
+func UploadLargeFile(ctx context.Context, backend Backend, obj *Object, size int64) error {
+	global.Logger.Debug("开始执行大文件上传", obj.Key)
 	file, err := os.Open(obj.FilePath)
 	if err != nil {
 		global.Logger.Error("Open File err :", err)
-		return errcode.File_OpenError.Msg()
+		return errcode.File_OpenError.Wrap(err)
 	}
 	defer file.Close()
+	fileInfo, err := file.Stat()
+	if err != nil {
+		global.Logger.Error("File Stat err :", err)
+		return errcode.File_OpenError.Wrap(err)
+	}
+	partSize := int64(global.ObjectSetting.Each_Section_Size << 20)
+
+	journal := loadJournal(obj)
+	if journal != nil && !journal.resumable(obj, fileInfo, partSize) {
+		global.Logger.Info("源文件已变化或断点记录失效，取消原分段上传: ", obj.Key, " UploadId: ", journal.UploadId)
+		abortMultipart(ctx, backend, obj, journal.UploadId)
+		removeJournal(obj)
+		journal = nil
+	}
+	if journal == nil {
+		// 1.初始化
+		start := time.Now()
+		initCtx, cancel := context.WithTimeout(ctx, requestTimeout())
+		uploadId, err := backend.InitMultipart(initCtx, obj)
+		cancel()
+		metrics.ObserveStage(backend.Name(), metrics.StageMultipartInit, start, err)
+		if err != nil {
+			global.Logger.Error("分段上传初始化失败,结束任务: ", err)
+			return err
+		}
+		journal = newJournal(obj, uploadId, fileInfo, partSize)
+		if err = journal.saveLocked(); err != nil {
+			global.Logger.Error("保存分段上传断点记录失败: ", obj.Key, err)
+		}
+	} else {
+		global.Logger.Info("续传未完成的分段上传: ", obj.Key, " 已完成分段数: ", len(journal.Parts))
+	}
+	global.Logger.Info("UploadId: ", journal.UploadId)
+	upload := startMultipart(backend, obj, journal.UploadId)
+	defer upload.finish()
+	// 2.开始上传小段对象，每段直接从原文件对应偏移读取，不再生成分段临时文件
+	uploadRsult, err := Multipart_Upload(ctx, backend, obj, journal, file, fileInfo.Size())
+	if err != nil {
+		if ctx.Err() != nil {
+			// 停止服务时由 Shutdown 决定取消上传还是保留断点记录
+			upload.interrupted = true
+			return err
+		}
+		// 保留断点记录，下次执行时续传
+		global.Logger.Info("分段上传未完成，保留断点记录: ", obj.Key)
+		return err
+	}
+	// 3.文件上传成功完结操作
+	// 服务端合并分段的耗时与文件大小有关
+	start := time.Now()
+	completeCtx, cancel := context.WithTimeout(ctx, transferTimeout(fileInfo.Size()))
+	err = backend.CompleteMultipart(completeCtx, obj, journal.UploadId, uploadRsult)
+	cancel()
+	metrics.ObserveStage(backend.Name(), metrics.StageMultipartComplete, start, err)
+	if err != nil && ctx.Err() != nil {
+		// 停止服务时由 Shutdown 决定取消上传还是保留断点记录
+		upload.interrupted = true
+		return err
+	}
+	if err != nil {
+		// 完结失败，取消操作
+		global.Logger.Error("完成对象分段上传失败: ", obj.Key, err)
+		abortMultipart(ctx, backend, obj, journal.UploadId)
+		removeJournal(obj)
+		return err
+	}
+	// 组合校验和，以及（分段按顺序计算时）整个文件的SHA-256
+	obj.Checksum = journal.checksum()
+	removeJournal(obj)
+	obj.Size = fileInfo.Size()
+	return nil
+}
 
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-
-	formFile, err := writer.CreateFormFile("file", obj.FilePath)
-	if err != nil {
-		global.Logger.Error("CreateFormFile err :", err, file)
-		return errcode.Http_HeadError.Msg()
-	}
-	_, err = io.Copy(formFile, file)
-	if err != nil {
-		global.Logger.Error("File Copy err :", err)
-		return errcode.File_CopyError.Msg()
-	}
-
-	writer.Close()
-	request, err := http.NewRequest("POST", url, body)
-	if err != nil {
-		global.Logger.Error("NewRequest err: ", err, url)
-		return errcode.Http_RequestError.Msg()
-	}
-	// 设置AK
-	request.Header.Set("accessKey", global.ObjectSetting.OBJECT_AK)
-	request.Header.Set("Content-Type", writer.FormDataContentType())
-	request.Header.Set("Connection", "close")
-	connectTimeout := 20 * time.Second
-	readWriteTimeout := 20 * time.Second
-	transport := http.Transport{
-		DisableKeepAlives: true,
-		// TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
-		Dial: TimeoutDialer(connectTimeout, readWriteTimeout),
-	}
-	client := &http.Client{
-		Transport: &transport,
-	}
-	resp, err := client.Do(request)
-	global.Logger.Info("开始发起http client.Do: ", obj.Key)
-	if err != nil {
-		global.Logger.Error("Do Request got err: ", err)
-		return errcode.Http_RequestError.Msg()
-	}
-	defer resp.Body.Close()
-
-	content, err := io.ReadAll(resp.Body)
-	if err != nil {
-		global.Logger.Error("ioutil.ReadAll err: ", err)
-		return errcode.Http_RespError.Msg()
+// // 2.分段对象上传
+// 同一文件的分段按 Multipart_Concurrency 并发上传，任一分段失败时取消其余在途分段，
+// 返回结果按 partNumber 升序排列，供完成分段上传使用
+func Multipart_Upload(ctx context.Context, backend Backend, obj *Object, journal *uploadJournal, file io.ReaderAt, fileSize int64) ([]global.FileResult, error) {
+	uploadid := journal.UploadId
+	global.Logger.Info(obj.Key, " 开始执行分段上传函数,UploadId: ", uploadid)
+	size := journal.PartSize
+	num := int((fileSize + size - 1) / size)
+	concurrency := global.ObjectSetting.Multipart_Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	sem := make(chan struct{}, concurrency)
+	chain := newChainHash(journal.HashState, journal.HashedParts)
+	for i := 1; i <= num; i++ {
+		if _, ok := journal.done(i); ok {
+			// 断点续传，跳过已完成的分段
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(v int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			offset := int64(v-1) * size
+			partSize := size
+			if offset+partSize > fileSize {
+				partSize = fileSize - offset
+			}
+			start := time.Now()
+			partCtx, partCancel := context.WithTimeout(ctx, transferTimeout(partSize))
+			body := newHashReader(obj.source.reader(partCtx, io.NewSectionReader(file, offset, partSize)))
+			chained := chain.claim(v)
+			if chained {
+				body.chain = chain
+			}
+			part := Part{
+				Number: v,
+				Offset: offset,
+				Size:   partSize,
+				Last:   v == num,
+				Body:   bandwidth.NewReader(partCtx, body, bandwidth.Default),
+			}
+			fileResult, err := backend.UploadPart(partCtx, obj, uploadid, part)
+			partCancel()
+			metrics.ObserveStage(backend.Name(), metrics.StageMultipartPart, start, err)
+			if err == nil && global.ObjectSetting.OBJECT_Checksum_Verify && !etagMatches(fileResult.Etag, body.Sum().MD5) {
+				global.Logger.Error(obj.Key, " :的第", v, "段ETag与本地MD5不一致, etag: ", fileResult.Etag, " md5: ", body.Sum().MD5)
+				err = ErrChecksumMismatch
+			}
+			var state []byte
+			if chained {
+				state = chain.done(err == nil)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				global.Logger.Info(obj.Key, " :的第", v, "段数据上传成功", fileResult)
+				journal.addPart(fileResult, body.Sum(), state)
+				return
+			}
+			if firstErr == nil {
+				global.Logger.Info(obj.Key, " :的第", v, "段数据上传失败: ", err)
+				firstErr = err
+				// 取消其他正在上传的分段
+				cancel()
+			}
+		}(i)
 	}
-	global.Logger.Info("resp.Body: ", string(content))
-	var result = make(map[string]interface{})
-	err = json.Unmarshal(content, &result)
-	if err != nil {
-		global.Logger.Error("resp.Body: ", "错误")
-		return errcode.Http_RespError.Msg()
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
 	}
-	// 解析json
-	if vCode, ok := result["code"]; ok {
-		resultcode := vCode.(string)
-		global.Logger.Info("resultcode: ", resultcode)
-		return resultcode
+	// 停止服务时未上传完所有分段就结束了循环，不能返回不完整的分段列表
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
-	return ""
+	return journal.partList(), nil
 }
 
-// // UploadLargeFile 上传大文件
-func UploadLargeFile(obj *Object, size int64) string {
-	global.Logger.Debug("开始执行大文件上传", obj.Key)
-	// num := math.Ceil(float64(size) / float64(global.ObjectSetting.Each_Section_Size))
-	// 1.初始化
-	UploadId := Multipart_Upload_Init(obj)
-	if UploadId == "" {
-		global.Logger.Error("分段上传初始化获取UploadId是空,结束任务")
-		return ""
+// 查询远端对象，校验大小以及（ETag为MD5时）校验和
+// 远端对象不存在或不一致时返回 ErrVerifyFailed，后端不支持查询时跳过校验
+func VerifyRemote(ctx context.Context, backend Backend, obj *Object) error {
+	start := time.Now()
+	headCtx, cancel := context.WithTimeout(ctx, requestTimeout())
+	defer cancel()
+	info, err := backend.Head(headCtx, obj)
+	if errors.Is(err, ErrNotSupported) {
+		global.Logger.Warn("存储后端不支持查询对象，跳过远端校验: ", backend.Name())
+		return nil
+	}
+	if err != nil {
+		var be *BackendError
+		if errors.As(err, &be) && be.StatusCode == http.StatusNotFound {
+			metrics.ObserveStage(backend.Name(), metrics.StageHead, start, nil)
+			return fmt.Errorf("%w: 远端对象不存在 %s", ErrVerifyFailed, obj.FileKey)
+		}
+		metrics.ObserveStage(backend.Name(), metrics.StageHead, start, err)
+		global.Logger.Error("查询远端对象失败: ", obj.Key, " err: ", err)
+		return err
 	}
-	global.Logger.Info("UploadId: ", UploadId)
-	// 2.开始上传小段对象
-	var uploadRsult []global.FileResult
-	var status bool
-	var code string
-	// 将大文件分成小文件
-	TragetSize := global.ObjectSetting.Each_Section_Size << 20
-	var fileMap = make(map[int]string)
-	fileMap = general.FileSplit(obj.FilePath, int64(TragetSize))
-	global.Logger.Debug("文件分段的map: ", fileMap)
-	status, uploadRsult = Multipart_Upload(obj, UploadId, fileMap)
-	if status {
-		// 文件上传成功完结操作
-		code = Multipart_Completion(obj, UploadId, uploadRsult)
-	} else {
-		// 文件上传失败取消操作
-		Multipart_Abortion(obj, UploadId)
+	metrics.ObserveStage(backend.Name(), metrics.StageHead, start, nil)
+	if info.Size != obj.Size {
+		return fmt.Errorf("%w: 大小不一致, 本地: %d, 远端: %d", ErrVerifyFailed, obj.Size, info.Size)
 	}
-	// 删除分段文件
-	for _, k := range fileMap {
-		os.Remove(k)
+	if obj.Checksum.MD5 != "" && !etagMatches(info.ETag, obj.Checksum.MD5) {
+		return fmt.Errorf("%w: 校验和不一致, 本地MD5: %s, 远端ETag: %s", ErrVerifyFailed, obj.Checksum.MD5, info.ETag)
 	}
-
-	return code
+	global.Logger.Debug("远端对象校验通过: ", obj.Key, " size: ", info.Size, " etag: ", info.ETag)
+	return nil
 }
 
 // 补偿操作
-func ReDo(obj *Object) bool {
+// 未超过补偿次数（OBJECT_Count）时，等待 delay 后重新放入任务队列，不占用worker；ctx 取消时放弃重试
+func ReDo(ctx context.Context, obj *Object, delay time.Duration) bool {
 	global.Logger.Info("开始补偿操作：", obj.Key)
 	if obj.Count < global.ObjectSetting.OBJECT_Count {
 		obj.Count += 1
@@ -347,340 +401,33 @@ func ReDo(obj *Object) bool {
 			Type:        obj.Type,
 			Count:       obj.Count,
 		}
-		global.ObjectDataChan <- data
-		return true
-	}
-	return false
-}
-
-func TimeoutDialer(cTimeout time.Duration, rwTimeout time.Duration) func(net, addr string) (c net.Conn, err error) {
-	return func(netw, addr string) (net.Conn, error) {
-		conn, err := net.DialTimeout(netw, addr, cTimeout)
-		if err != nil {
-			return nil, err
-		}
-		conn.SetDeadline(time.Now().Add(rwTimeout))
-		return conn, nil
-	}
-}
-
-// // 1.文件分段上传初始化
-func Multipart_Upload_Init(obj *Object) string {
-	global.Logger.Debug("文件分段上传初始化", obj.Key)
-	url := global.ObjectSetting.OBJECT_Multipart_Init_URL
-	url += "//"
-	url += global.ObjectSetting.OBJECT_ResId
-	url += "//"
-	url += obj.FileKey
-	request, err := http.NewRequest("POST", url, nil)
-	if err != nil {
-		global.Logger.Error("NewRequest err: ", err, url)
-		return errcode.Http_RequestError.Msg()
-	}
-	// 设置AK
-	request.Header.Set("accessKey", global.ObjectSetting.OBJECT_AK)
-	request.Header.Set("Content-Type", "application/json;charset=UTF-8")
-	request.Header.Set("Connection", "close")
-	connectTimeout := 20 * time.Second
-	readWriteTimeout := 20 * time.Second
-	transport := http.Transport{
-		DisableKeepAlives: true,
-		// TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
-		Dial: TimeoutDialer(connectTimeout, readWriteTimeout),
-	}
-	client := &http.Client{
-		Transport: &transport,
-	}
-	resp, err := client.Do(request)
-	global.Logger.Info("开始发起http client.Do: ", obj.Key)
-	if err != nil {
-		global.Logger.Error("Do Request got err: ", err)
-		return errcode.Http_RequestError.Msg()
-	}
-	defer resp.Body.Close()
-
-	content, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return errcode.Http_RespError.Msg()
-	}
-	global.Logger.Info("resp.Body: ", string(content))
-	var result = make(map[string]interface{})
-	err = json.Unmarshal(content, &result)
-	if err != nil {
-		global.Logger.Error("resp.Body: ", "错误")
-		return errcode.Http_RespError.Msg()
-	}
-
-	// 解析json
-	if vCode, ok := result["code"]; ok {
-		resultcode := vCode.(string)
-		if resultcode != "00000" {
-			global.Logger.Error("文件分段上传初始化接口返回错误", resultcode)
-			return ""
-		}
-	}
-	if vData, ok := result["data"]; ok {
-		dataMap := vData.(map[string]interface{})
-		uploadId := dataMap["uploadId"].(string)
-		return uploadId
-	}
-	return ""
-}
-
-// // 2.分段对象上传
-func Multipart_Upload(obj *Object, uploadid string, fileMap map[int]string) (bool, []global.FileResult) {
-	global.Logger.Info(obj.Key, " 开始执行分段上传函数,UploadId: ", uploadid)
-	status := true
-	size := global.ObjectSetting.Each_Section_Size << 20
-	var fileResultList []global.FileResult
-	num := len(fileMap)
-	for v, k := range fileMap {
-		// 讲分段文件多线程上传修改为单线程上传
-		var code string
-		var index int
-		var fileResult global.FileResult
-		if status {
-			if v == num {
-				index, code, fileResult = Multipart_Unifile(obj, k, uploadid, int64(size), v, true)
-			} else {
-				index, code, fileResult = Multipart_Unifile(obj, k, uploadid, int64(size), v, false)
+		go func() {
+			timer := time.NewTimer(delay)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				return
 			}
-			if code == "00000" {
-				//上传成功更新数据库
-				global.Logger.Info(obj.Key, " :的第", index, "段数据上传成功", fileResult)
-				fileResultList = append(fileResultList, fileResult)
-			} else {
-				global.Logger.Info(obj.Key, " :的第", index, "段数据上传失败: ", code)
-				// model.UpdateUplaode(obj.InstanceKey, obj.Key, false)
-				status = false
+			// 队列已满时等待，停止服务时放弃重新上传
+			select {
+			case global.ObjectDataChan <- data:
+			case <-ctx.Done():
 			}
-		}
-	}
-	return status, fileResultList
-}
-
-// 分段单文件处理
-func Multipart_Unifile(obj *Object, filepath string, uploadid string, size int64, num int, flag bool) (int, string, global.FileResult) {
-	global.Logger.Debug("文件分段上传单文件: ", obj.Key, " 当前分段：", num)
-	var resultdata global.FileResult
-	var resultcode string
-	url := global.ObjectSetting.OBJECT_Multipart_Upload_URL
-	url += "//"
-	url += global.ObjectSetting.OBJECT_ResId
-	url += "//"
-	url += obj.FileKey
-	file, err := os.Open(filepath)
-	if err != nil {
-		return num, errcode.File_OpenError.Msg(), resultdata
-	}
-	defer file.Close()
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-	// writer.WriteField("resId", global.ObjectSetting.OBJECT_ResId)
-	// writer.WriteField("key", obj.FileKey)
-	writer.WriteField("uploadId", uploadid)
-	writer.WriteField("filePosition", fmt.Sprintf("%d", int64(num-1)*size))
-	writer.WriteField("partNumber", fmt.Sprintf("%d", num))
-	if flag {
-		writer.WriteField("lastPart", "true")
-	}
-	formFile, err := writer.CreateFormFile("file", filepath)
-	if err != nil {
-		global.Logger.Error("CreateFormFile err :", err, file)
-		return num, errcode.Http_HeadError.Msg(), resultdata
-	}
-	_, err = io.Copy(formFile, file)
-	if err != nil {
-		global.Logger.Error("io.Copy err :", err, file)
-		return num, errcode.File_CopyError.Msg(), resultdata
-	}
-	writer.Close()
-	request, err := http.NewRequest("POST", url, body)
-	// global.Logger.Debug(body)
-	if err != nil {
-		global.Logger.Error("NewRequest err: ", err, url)
-		return num, errcode.Http_RequestError.Msg(), resultdata
-	}
-	// request.Header.Set("Authorization", token)
-	// 设置AK
-	request.Header.Set("accessKey", global.ObjectSetting.OBJECT_AK)
-	request.Header.Set("Content-Type", writer.FormDataContentType())
-	request.Header.Set("Connection", "close")
-	connectTimeout := 20 * time.Second
-	readWriteTimeout := 20 * time.Second
-	transport := http.Transport{
-		DisableKeepAlives: true,
-		// TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
-		Dial: TimeoutDialer(connectTimeout, readWriteTimeout),
-	}
-	client := &http.Client{
-		Transport: &transport,
-	}
-	resp, err := client.Do(request)
-	if err != nil {
-		global.Logger.Error("Do Request got err: ", err)
-		return num, errcode.Http_RequestError.Msg(), resultdata
-	}
-	defer resp.Body.Close()
-	content, err := io.ReadAll(resp.Body)
-	if err != nil {
-		global.Logger.Error("ioutil.ReadAll got err: ", err)
-		return num, errcode.Http_RespError.Msg(), resultdata
-	}
-	global.Logger.Info("resp.Body: ", string(content))
-	var result = make(map[string]interface{})
-	err = json.Unmarshal(content, &result)
-	if err != nil {
-		global.Logger.Error("resp.Body: ", "错误")
-		return num, errcode.Http_RespError.Msg(), resultdata
-	}
-	// 解析json
-	if vCode, ok := result["code"]; ok {
-		resultcode = vCode.(string)
-		if resultcode != "00000" {
-			global.Logger.Error("文件分段上传初始化接口返回错误", resultcode)
-			return num, resultcode, resultdata
-		}
-	}
-	if vData, ok := result["data"]; ok {
-		dataMap := vData.(map[string]interface{})
-		global.Logger.Debug(dataMap)
-		partNumber := int(dataMap["partNumber"].(float64))
-		etag := dataMap["etag"].(string)
-		resultdata.PartNumber = partNumber
-		resultdata.Etag = etag
-		global.Logger.Debug("resultdata: ", resultdata)
-	}
-	global.Logger.Debug("key: ", obj.Key, "num: ", num, ", resultcode: ", resultcode, ", resultdata", resultdata)
-	return num, resultcode, resultdata
-}
-
-// 完成对象分段上传
-func Multipart_Completion(obj *Object, uploadid string, fileresult []global.FileResult) string {
-	global.Logger.Debug("完成对象分段上传: ", obj.Key)
-	url := global.ObjectSetting.OBJECT_Multipart_Completion_URL
-	url += "//"
-	url += global.ObjectSetting.OBJECT_ResId
-	url += "//"
-	url += obj.FileKey
-	jsonData := global.JosnData{
-		UploadId:  uploadid,
-		PartEtags: fileresult,
-	}
-	global.Logger.Info(jsonData)
-
-	jsonstr, err := json.Marshal(jsonData)
-	if err != nil {
-		global.Logger.Error(err)
-		return err.Error()
-	}
-	reader := bytes.NewBuffer(jsonstr)
-	global.Logger.Info(string(jsonstr))
-
-	request, err := http.NewRequest("POST", url, reader)
-	if err != nil {
-		global.Logger.Error("NewRequest err: ", err, url)
-		return errcode.Http_RequestError.Msg()
-	}
-	// 设置AK
-	request.Header.Set("accessKey", global.ObjectSetting.OBJECT_AK)
-	request.Header.Set("Content-Type", "application/json;charset=UTF-8")
-	request.Header.Set("Connection", "close")
-	connectTimeout := 20 * time.Second
-	readWriteTimeout := 20 * time.Second
-	transport := http.Transport{
-		DisableKeepAlives: true,
-		// TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
-		Dial: TimeoutDialer(connectTimeout, readWriteTimeout),
-	}
-	client := &http.Client{
-		Transport: &transport,
-	}
-	resp, err := client.Do(request)
-	if err != nil {
-		global.Logger.Error("Do Request got err: ", err)
-		return errcode.Http_RequestError.Msg()
-	}
-	defer resp.Body.Close()
-
-	content, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return errcode.Http_RespError.Msg()
-	}
-	global.Logger.Info("resp.Body: ", string(content))
-	var result = make(map[string]interface{})
-	err = json.Unmarshal(content, &result)
-	if err != nil {
-		global.Logger.Error("resp.Body: ", "错误")
-		return errcode.Http_RespError.Msg()
-	}
-	// 解析json
-	if vCode, ok := result["code"]; ok {
-		resultcode := vCode.(string)
-		global.Logger.Info("resultcode: ", resultcode)
-		return resultcode
+		}()
+		return true
 	}
-	return ""
+	return false
 }
 
-// 取消对象分段上传
-func Multipart_Abortion(obj *Object, uploadid string) string {
-	global.Logger.Debug("取消对象分段上传: ", obj.Key, " Uploadid: ", uploadid)
-	url := global.ObjectSetting.OBJECT_Multipart_Abortion_URL
-	url += "//"
-	url += global.ObjectSetting.OBJECT_ResId
-	url += "//"
-	url += obj.FileKey
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-	writer.WriteField("uploadId", uploadid)
-
-	writer.Close()
-	request, err := http.NewRequest("POST", url, body)
-	// global.Logger.Debug(body)
-	if err != nil {
-		global.Logger.Error("NewRequest err: ", err, url)
-		return ""
-	}
-	// request.Header.Set("Authorization", token)
-	// 设置AK
-	request.Header.Set("accessKey", global.ObjectSetting.OBJECT_AK)
-	request.Header.Set("Content-Type", writer.FormDataContentType())
-	request.Header.Set("Connection", "close")
-	connectTimeout := 20 * time.Second
-	readWriteTimeout := 20 * time.Second
-	transport := http.Transport{
-		DisableKeepAlives: true,
-		// TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
-		Dial: TimeoutDialer(connectTimeout, readWriteTimeout),
-	}
-	client := &http.Client{
-		Transport: &transport,
-	}
-	resp, err := client.Do(request)
-	if err != nil {
-		global.Logger.Error("Do Request got err: ", err)
-		return ""
-	}
-
-	defer resp.Body.Close()
-	content, err := io.ReadAll(resp.Body)
-	if err != nil {
-		global.Logger.Error("ioutil.ReadAll got err: ", err)
-		return ""
-	}
-	global.Logger.Info("取消对象分段上传 resp.Body: ", string(content))
-	var result = make(map[string]interface{})
-	err = json.Unmarshal(content, &result)
-	if err != nil {
-		global.Logger.Error("resp.Body: ", "错误")
-		return ""
+// 取消分段上传，任务已取消时仍然发起请求
+func abortMultipart(ctx context.Context, backend Backend, obj *Object, uploadid string) {
+	if ctx.Err() != nil {
+		ctx = context.Background()
 	}
-	// 解析json
-	if vCode, ok := result["code"]; ok {
-		resultcode := vCode.(string)
-		global.Logger.Info("resultcode: ", resultcode)
-		return resultcode
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout())
+	defer cancel()
+	if err := backend.AbortMultipart(ctx, obj, uploadid); err != nil {
+		global.Logger.Error("取消分段上传失败: ", obj.Key, " UploadId: ", uploadid, " err: ", err)
 	}
-	return ""
 }
@@ -0,0 +1,166 @@
+package object
+
+import (
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/global"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 创建稀疏文件（内容全部为0，不占用磁盘空间）
+func sparseFile(t *testing.T, size int64) string {
+	path := filepath.Join(t.TempDir(), "sparse.dcm")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err = file.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// 上传期间定时采样堆内存，返回相对开始时的最大增长
+func peakHeapGrowth(t *testing.T, upload func() error) uint64 {
+	var ms runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&ms)
+	base, peak := ms.HeapAlloc, ms.HeapAlloc
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				var ms runtime.MemStats
+				runtime.ReadMemStats(&ms)
+				if ms.HeapAlloc > peak {
+					peak = ms.HeapAlloc
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	err := upload()
+	close(done)
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peak < base {
+		return 0
+	}
+	return peak - base
+}
+
+// 上传大文件时按流读取，内存占用与文件大小无关
+func TestUploadStreamsLargeFile(t *testing.T) {
+	if testing.Short() {
+		t.Skip("大文件测试")
+	}
+	const size = 256 << 20
+	const limit = 64 << 20
+	fake := newFakeS3(false)
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	backend := newTestS3Backend(t, srv, fake)
+	path := sparseFile(t, size)
+
+	t.Run("UploadFile", func(t *testing.T) {
+		obj := &Object{Key: 10, FileKey: "2026/10.dcm", FilePath: path}
+		growth := peakHeapGrowth(t, func() error {
+			return UploadFile(context.Background(), backend, obj)
+		})
+		if remote := fake.object(obj.FileKey); remote == nil || remote.size != size {
+			t.Fatalf("远端对象大小不一致: %+v", remote)
+		}
+		if growth > limit {
+			t.Errorf("上传 %dMB 文件堆内存增长 %dMB, 超过 %dMB", size>>20, growth>>20, limit>>20)
+		}
+	})
+	t.Run("UploadLargeFile", func(t *testing.T) {
+		obj := &Object{Key: 11, FileKey: "2026/11.dcm", FilePath: path}
+		growth := peakHeapGrowth(t, func() error {
+			return UploadLargeFile(context.Background(), backend, obj, size)
+		})
+		if remote := fake.object(obj.FileKey); remote == nil || remote.size != size {
+			t.Fatalf("远端对象大小不一致: %+v", remote)
+		}
+		if growth > limit {
+			t.Errorf("分段上传 %dMB 文件堆内存增长 %dMB, 超过 %dMB", size>>20, growth>>20, limit>>20)
+		}
+	})
+}
+
+// 上传完一个分段后取消（停止服务）
+type cancelAfterPart struct {
+	*s3Backend
+	cancel context.CancelFunc
+}
+
+func (b *cancelAfterPart) UploadPart(ctx context.Context, obj *Object, uploadid string, part Part) (global.FileResult, error) {
+	result, err := b.s3Backend.UploadPart(ctx, obj, uploadid, part)
+	b.cancel()
+	return result, err
+}
+
+// 分段之间停止服务时返回错误并保留断点记录，不完成也不取消分段上传
+func TestMultipartCancelledBetweenParts(t *testing.T) {
+	old := global.ObjectSetting
+	defer func() { global.ObjectSetting = old }()
+	setting := *old
+	setting.Multipart_Concurrency = 1
+	global.ObjectSetting = &setting
+
+	fake := newFakeS3(false)
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	backend := &cancelAfterPart{s3Backend: newTestS3Backend(t, srv, fake), cancel: cancel}
+
+	size := 2*testPartSize + 1
+	path, data := writeTestFile(t, size)
+	obj := &Object{Key: 12, FileKey: "2026/12.dcm", FilePath: path}
+	defer removeJournal(obj)
+	if err := UploadLargeFile(ctx, backend, obj, int64(size)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("UploadLargeFile err = %v, want context.Canceled", err)
+	}
+	if fake.object(obj.FileKey) != nil {
+		t.Error("未上传完所有分段时不能完成分段上传")
+	}
+	if len(fake.aborted) != 0 || len(fake.uploads) != 1 {
+		t.Errorf("分段上传被取消: aborted %v, uploads %d", fake.aborted, len(fake.uploads))
+	}
+	journal := loadJournal(obj)
+	if journal == nil || len(journal.Parts) != 1 || journal.HashedParts != 1 {
+		t.Fatalf("断点记录 = %+v, want 1个已完成分段", journal)
+	}
+
+	// 续传剩余分段，继续按顺序计算整个文件的SHA-256
+	backend.cancel = func() {}
+	if err := UploadLargeFile(context.Background(), backend, obj, int64(size)); err != nil {
+		t.Fatal(err)
+	}
+	if remote := fake.object(obj.FileKey); remote == nil || remote.size != int64(size) {
+		t.Fatalf("远端对象大小不一致: %+v", remote)
+	}
+	if sum := sha256.Sum256(data); obj.Checksum.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("SHA256 = %s, want %x", obj.Checksum.SHA256, sum)
+	}
+}
@@ -0,0 +1,236 @@
+package object
+
+import (
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/global"
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/errcode"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+)
+
+func init() {
+	RegisterBackend(BackendPlatform, func() (Backend, error) {
+		return &platformBackend{}, nil
+	})
+}
+
+// 通过平台接口转发上传
+type platformBackend struct{}
+
+func (b *platformBackend) Name() string {
+	return BackendPlatform
+}
+
+// 发起平台接口请求并解析返回的json，返回码不是 SuccessCode 时返回 BackendError
+func doPlatformRequest(request *http.Request) (map[string]interface{}, error) {
+	// 设置AK
+	request.Header.Set("accessKey", global.ObjectSetting.OBJECT_AK)
+	resp, err := httpClient().Do(request)
+	if err != nil {
+		global.Logger.Error("Do Request got err: ", err)
+		return nil, errcode.Http_RequestError.Wrap(err)
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		global.Logger.Error("ioutil.ReadAll err: ", err)
+		return nil, errcode.Http_RespError.Wrap(err)
+	}
+	global.Logger.Info("resp.Body: ", string(content))
+	var result = make(map[string]interface{})
+	err = json.Unmarshal(content, &result)
+	if err != nil {
+		global.Logger.Error("resp.Body: ", "错误")
+		return nil, &BackendError{Code: errcode.Http_RespError.Msg(), StatusCode: resp.StatusCode, Msg: string(content), RetryAfter: retryAfter(resp.Header)}
+	}
+	// 解析json
+	resultcode, _ := result["code"].(string)
+	global.Logger.Info("resultcode: ", resultcode)
+	if resultcode != SuccessCode {
+		msg, _ := result["msg"].(string)
+		return result, &BackendError{Code: resultcode, StatusCode: resp.StatusCode, Msg: msg, RetryAfter: retryAfter(resp.Header)}
+	}
+	return result, nil
+}
+
+type formField struct {
+	name  string
+	value string
+}
+
+// 构造流式multipart表单请求体：普通字段 + 文件字段
+// 表单头与表单尾在内存中生成，文件数据直接从 data 读取，返回请求体、Content-Type 和总长度
+func newFormBody(fields []formField, filename string, data io.Reader, size int64) (io.Reader, string, int64, error) {
+	form := &bytes.Buffer{}
+	writer := multipart.NewWriter(form)
+	for _, f := range fields {
+		if err := writer.WriteField(f.name, f.value); err != nil {
+			return nil, "", 0, err
+		}
+	}
+	if _, err := writer.CreateFormFile("file", filename); err != nil {
+		return nil, "", 0, err
+	}
+	headLen := form.Len()
+	writer.Close()
+	content := form.Bytes()
+	body := io.MultiReader(bytes.NewReader(content[:headLen]), data, bytes.NewReader(content[headLen:]))
+	return body, writer.FormDataContentType(), int64(len(content)) + size, nil
+}
+
+// 上传文件
+func (b *platformBackend) Put(ctx context.Context, obj *Object, data io.Reader, size int64) (string, error) {
+	global.Logger.Debug("开始执行文件上传")
+	url := objectURL(global.ObjectSetting.OBJECT_POST_Upload, obj)
+	global.Logger.Debug("操作的URL: ", url)
+	body, contentType, length, err := newFormBody(nil, obj.FilePath, data, size)
+	if err != nil {
+		global.Logger.Error("CreateFormFile err :", err)
+		return "", errcode.Http_HeadError.Wrap(err)
+	}
+	request, err := http.NewRequestWithContext(ctx, "POST", url, body)
+	if err != nil {
+		global.Logger.Error("NewRequest err: ", err, url)
+		return "", errcode.Http_RequestError.Wrap(err)
+	}
+	request.ContentLength = length
+	request.Header.Set("Content-Type", contentType)
+	global.Logger.Info("开始发起http client.Do: ", obj.Key)
+	result, err := doPlatformRequest(request)
+	if err != nil {
+		return "", err
+	}
+	// 平台返回etag时用于校验
+	var etag string
+	if dataMap, ok := result["data"].(map[string]interface{}); ok {
+		etag, _ = dataMap["etag"].(string)
+	}
+	return etag, nil
+}
+
+// 1.文件分段上传初始化
+func (b *platformBackend) InitMultipart(ctx context.Context, obj *Object) (string, error) {
+	global.Logger.Debug("文件分段上传初始化", obj.Key)
+	url := objectURL(global.ObjectSetting.OBJECT_Multipart_Init_URL, obj)
+	request, err := http.NewRequestWithContext(ctx, "POST", url, nil)
+	if err != nil {
+		global.Logger.Error("NewRequest err: ", err, url)
+		return "", errcode.Http_RequestError.Wrap(err)
+	}
+	request.Header.Set("Content-Type", "application/json;charset=UTF-8")
+	global.Logger.Info("开始发起http client.Do: ", obj.Key)
+	result, err := doPlatformRequest(request)
+	if err != nil {
+		global.Logger.Error("文件分段上传初始化接口返回错误", err)
+		return "", err
+	}
+	if dataMap, ok := result["data"].(map[string]interface{}); ok {
+		if uploadId, ok := dataMap["uploadId"].(string); ok && uploadId != "" {
+			return uploadId, nil
+		}
+	}
+	return "", errcode.Http_RespError.WithDetails("uploadId为空")
+}
+
+// 2.分段对象上传
+func (b *platformBackend) UploadPart(ctx context.Context, obj *Object, uploadid string, part Part) (global.FileResult, error) {
+	global.Logger.Debug("文件分段上传单文件: ", obj.Key, " 当前分段：", part.Number)
+	var resultdata global.FileResult
+	url := objectURL(global.ObjectSetting.OBJECT_Multipart_Upload_URL, obj)
+	fields := []formField{
+		{"uploadId", uploadid},
+		{"filePosition", fmt.Sprintf("%d", part.Offset)},
+		{"partNumber", fmt.Sprintf("%d", part.Number)},
+	}
+	if part.Last {
+		fields = append(fields, formField{"lastPart", "true"})
+	}
+	body, contentType, length, err := newFormBody(fields, obj.FilePath, part.Body, part.Size)
+	if err != nil {
+		global.Logger.Error("CreateFormFile err :", err, obj.FilePath)
+		return resultdata, errcode.Http_HeadError.Wrap(err)
+	}
+	request, err := http.NewRequestWithContext(ctx, "POST", url, body)
+	if err != nil {
+		global.Logger.Error("NewRequest err: ", err, url)
+		return resultdata, errcode.Http_RequestError.Wrap(err)
+	}
+	request.ContentLength = length
+	request.Header.Set("Content-Type", contentType)
+	result, err := doPlatformRequest(request)
+	if err != nil {
+		global.Logger.Error("文件分段上传接口返回错误", err)
+		return resultdata, err
+	}
+	dataMap, ok := result["data"].(map[string]interface{})
+	if !ok {
+		return resultdata, errcode.Http_RespError.WithDetails("分段上传结果为空")
+	}
+	global.Logger.Debug(dataMap)
+	if partNumber, ok := dataMap["partNumber"].(float64); ok {
+		resultdata.PartNumber = int(partNumber)
+	}
+	resultdata.Etag, _ = dataMap["etag"].(string)
+	global.Logger.Debug("key: ", obj.Key, "num: ", part.Number, ", resultdata", resultdata)
+	return resultdata, nil
+}
+
+// 3.完成对象分段上传
+func (b *platformBackend) CompleteMultipart(ctx context.Context, obj *Object, uploadid string, fileresult []global.FileResult) error {
+	global.Logger.Debug("完成对象分段上传: ", obj.Key)
+	url := objectURL(global.ObjectSetting.OBJECT_Multipart_Completion_URL, obj)
+	jsonData := global.JosnData{
+		UploadId:  uploadid,
+		PartEtags: fileresult,
+	}
+	jsonstr, err := json.Marshal(jsonData)
+	if err != nil {
+		global.Logger.Error(err)
+		return err
+	}
+	global.Logger.Info(string(jsonstr))
+
+	request, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(jsonstr))
+	if err != nil {
+		global.Logger.Error("NewRequest err: ", err, url)
+		return errcode.Http_RequestError.Wrap(err)
+	}
+	request.Header.Set("Content-Type", "application/json;charset=UTF-8")
+	_, err = doPlatformRequest(request)
+	return err
+}
+
+// 取消对象分段上传
+func (b *platformBackend) AbortMultipart(ctx context.Context, obj *Object, uploadid string) error {
+	global.Logger.Debug("取消对象分段上传: ", obj.Key, " Uploadid: ", uploadid)
+	url := objectURL(global.ObjectSetting.OBJECT_Multipart_Abortion_URL, obj)
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	writer.WriteField("uploadId", uploadid)
+	writer.Close()
+	request, err := http.NewRequestWithContext(ctx, "POST", url, body)
+	if err != nil {
+		global.Logger.Error("NewRequest err: ", err, url)
+		return errcode.Http_RequestError.Wrap(err)
+	}
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	_, err = doPlatformRequest(request)
+	return err
+}
+
+// 查询远端对象
+// 平台没有提供查询对象信息的接口（上传地址不支持HEAD），不支持远端校验
+func (b *platformBackend) Head(ctx context.Context, obj *Object) (*ObjectInfo, error) {
+	return nil, ErrNotSupported
+}
+
+// 删除远端对象
+// 平台没有提供删除对象的接口，不支持删除
+func (b *platformBackend) Delete(ctx context.Context, obj *Object) error {
+	return ErrNotSupported
+}
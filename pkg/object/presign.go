@@ -0,0 +1,146 @@
+package object
+
+import (
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/global"
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/errcode"
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/metrics"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func init() {
+	RegisterBackend(BackendS3Presign, func() (Backend, error) {
+		return &presignBackend{}, nil
+	})
+}
+
+// 通过平台获取S3临时上传地址后直接上传
+// 临时地址只支持单次上传，查询和删除对象仍通过平台接口完成
+type presignBackend struct {
+	platformBackend
+}
+
+func (b *presignBackend) Name() string {
+	return BackendS3Presign
+}
+
+// S3接口直接上传数据
+func (b *presignBackend) Put(ctx context.Context, obj *Object, body io.Reader, size int64) (string, error) {
+	// 1.获取临时上传地址
+	global.Logger.Debug("开始获取临时地址")
+	url := objectURL(global.ObjectSetting.OBJECT_Temp_GET_Upload, obj)
+	global.Logger.Debug("操作的URL: ", url)
+	start := time.Now()
+	presignCtx, cancel := context.WithTimeout(ctx, requestTimeout())
+	s3url, err := GetS3URL(presignCtx, url)
+	cancel()
+	metrics.ObserveStage(b.Name(), metrics.StagePresign, start, err)
+	if err != nil {
+		global.Logger.Error("获取S3临时上传地址错误", err)
+		return "", err
+	}
+	// 2.通过临时上传地址上传数据
+	global.Logger.Debug("开始通过临时地址上传：", s3url)
+	return Upload_S3(ctx, s3url, obj, body, size)
+}
+
+func (b *presignBackend) InitMultipart(ctx context.Context, obj *Object) (string, error) {
+	return "", ErrNotSupported
+}
+
+func (b *presignBackend) UploadPart(ctx context.Context, obj *Object, uploadid string, part Part) (global.FileResult, error) {
+	return global.FileResult{}, ErrNotSupported
+}
+
+func (b *presignBackend) CompleteMultipart(ctx context.Context, obj *Object, uploadid string, parts []global.FileResult) error {
+	return ErrNotSupported
+}
+
+func (b *presignBackend) AbortMultipart(ctx context.Context, obj *Object, uploadid string) error {
+	return ErrNotSupported
+}
+
+// 获取S3临时上传地址
+func GetS3URL(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		global.Logger.Error("http.NewRequest err", err)
+		return "", err
+	}
+	// 设置AK
+	req.Header.Set("accessKey", global.ObjectSetting.OBJECT_AK)
+
+	// 设置参数
+	q := req.URL.Query()
+	q.Add("expireTime", "60000")
+	req.URL.RawQuery = q.Encode()
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		global.Logger.Error("client.do err", err)
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	code := resp.StatusCode
+	if code != 200 {
+		global.Logger.Error("获取临时地址失败:", resp.StatusCode)
+		return "", &BackendError{Code: strconv.Itoa(code), StatusCode: code, Msg: "获取临时地址失败", RetryAfter: retryAfter(resp.Header)}
+	}
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		global.Logger.Error("ioutil.ReadAll err: ", err)
+		return "", errcode.Http_RespError
+	}
+	global.Logger.Info("resp.Body: ", string(content))
+	var result = make(map[string]interface{})
+	err = json.Unmarshal(content, &result)
+	if err != nil {
+		global.Logger.Error("resp.Body: ", "错误")
+		return "", errcode.Http_RespError
+	}
+	// 平台返回码（如限流）
+	if vCode, ok := result["code"].(string); ok && vCode != SuccessCode {
+		msg, _ := result["msg"].(string)
+		return "", &BackendError{Code: vCode, StatusCode: code, Msg: msg, RetryAfter: retryAfter(resp.Header)}
+	}
+	// 解析json
+	if resultUrl, ok := result["data"].(string); ok {
+		global.Logger.Info("resultUrl: ", resultUrl)
+		return resultUrl, nil
+	}
+	return "", errcode.Http_RespError
+}
+
+// S3上传数据
+// 请求体直接使用文件流，不再整体读入内存，每个worker的内存占用与文件大小无关
+// 返回S3的 ETag
+func Upload_S3(ctx context.Context, url string, obj *Object, body io.Reader, size int64) (string, error) {
+	global.Logger.Info("http.NewRequest 开始请求上传文件", obj.Key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, body)
+	if err != nil {
+		global.Logger.Error("http.NewRequest err", err)
+		return "", err
+	}
+	// 明确设置Content-Length，避免使用chunked编码（S3预签名地址不支持）
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		global.Logger.Error("client.do err", err)
+		return "", err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	code := resp.StatusCode
+	global.Logger.Debug("S3上传数据 resp.StatusCode:", resp.StatusCode)
+	if code != 200 {
+		return "", &BackendError{Code: strconv.Itoa(code), StatusCode: code, Msg: resp.Status, RetryAfter: retryAfter(resp.Header)}
+	}
+	return resp.Header.Get("ETag"), nil
+}
@@ -0,0 +1,107 @@
+package object
+
+import (
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/global"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 模拟平台获取临时地址接口和S3预签名地址
+// GET 返回临时上传地址，PUT 按流接收数据，只记录大小和MD5，不保存内容
+type fakePresign struct {
+	srv *httptest.Server
+
+	mu            sync.Mutex
+	accessKey     string
+	expireTime    string
+	contentLength int64
+	chunked       bool
+	received      int64
+	md5           string
+}
+
+func newFakePresign() *fakePresign {
+	f := &fakePresign{}
+	f.srv = httptest.NewServer(f)
+	return f
+}
+
+func (f *fakePresign) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		f.mu.Lock()
+		f.accessKey = r.Header.Get("accessKey")
+		f.expireTime = r.URL.Query().Get("expireTime")
+		f.mu.Unlock()
+		key := r.URL.Path[strings.LastIndex(r.URL.Path, "//")+2:]
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"code": SuccessCode,
+			"data": f.srv.URL + "/put/" + key + "?X-Amz-Signature=test",
+		})
+	case http.MethodPut:
+		h := md5.New()
+		n, err := io.Copy(h, r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		sum := hex.EncodeToString(h.Sum(nil))
+		f.mu.Lock()
+		f.contentLength = r.ContentLength
+		f.chunked = len(r.TransferEncoding) > 0
+		f.received = n
+		f.md5 = sum
+		f.mu.Unlock()
+		w.Header().Set("ETag", `"`+sum+`"`)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// 通过临时地址上传数GB的文件时按流发送，内存占用与文件大小无关
+func TestPresignStreamsLargeFile(t *testing.T) {
+	if testing.Short() {
+		t.Skip("大文件测试")
+	}
+	const size = 3 << 30
+	const limit = 64 << 20
+	fake := newFakePresign()
+	defer fake.srv.Close()
+
+	old := global.ObjectSetting
+	defer func() { global.ObjectSetting = old }()
+	setting := *old
+	setting.OBJECT_Temp_GET_Upload = fake.srv.URL + "/temp"
+	setting.OBJECT_ResId = "res"
+	setting.OBJECT_AK = "ak"
+	global.ObjectSetting = &setting
+
+	path := sparseFile(t, size)
+	obj := &Object{Key: 40, FileKey: "2026/40.dcm", FilePath: path}
+	growth := peakHeapGrowth(t, func() error {
+		return UploadFile(context.Background(), &presignBackend{}, obj)
+	})
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if fake.accessKey != "ak" || fake.expireTime != "60000" {
+		t.Errorf("获取临时地址请求 accessKey = %q, expireTime = %q", fake.accessKey, fake.expireTime)
+	}
+	if fake.chunked || fake.contentLength != size {
+		t.Errorf("PUT Content-Length = %d, chunked = %v, want %d", fake.contentLength, fake.chunked, int64(size))
+	}
+	if fake.received != size || fake.md5 != obj.Checksum.MD5 {
+		t.Fatalf("接收 %d 字节 MD5 %s, want %d 字节 MD5 %s", fake.received, fake.md5, int64(size), obj.Checksum.MD5)
+	}
+	if growth > limit {
+		t.Errorf("上传 %dMB 文件堆内存增长 %dMB, 超过 %dMB", size>>20, growth>>20, limit>>20)
+	}
+}
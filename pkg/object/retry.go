@@ -0,0 +1,162 @@
+package object
+
+import (
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/global"
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/errcode"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 上传失败的错误分类
+type errorClass int
+
+const (
+	errPermanent errorClass = iota // 重试也不会成功，直接更新为上传失败
+	errTransient                   // 网络中断、超时、服务端5xx等，延迟后重试
+	errThrottled                   // 平台限流（A2105）或HTTP 429/503，延迟后重试
+)
+
+func (c errorClass) String() string {
+	switch c {
+	case errTransient:
+		return "transient"
+	case errThrottled:
+		return "throttled"
+	}
+	return "permanent"
+}
+
+// S3返回的限流错误码
+var s3ThrottledCodes = map[string]bool{
+	"SlowDown":             true,
+	"Throttling":           true,
+	"ThrottlingException":  true,
+	"RequestLimitExceeded": true,
+}
+
+// S3返回的可重试错误码
+var s3TransientCodes = map[string]bool{
+	"RequestTimeout":     true,
+	"InternalError":      true,
+	"ServiceUnavailable": true,
+}
+
+// 对上传错误分类
+func classifyError(err error) errorClass {
+	var be *BackendError
+	if errors.As(err, &be) {
+		switch {
+		case be.Code == ThrottledCode || s3ThrottledCodes[be.Code]:
+			return errThrottled
+		case be.StatusCode == http.StatusTooManyRequests || be.StatusCode == http.StatusServiceUnavailable:
+			return errThrottled
+		case s3TransientCodes[be.Code]:
+			return errTransient
+		case be.StatusCode >= 500 || be.StatusCode == http.StatusRequestTimeout:
+			return errTransient
+		}
+		return errPermanent
+	}
+	var ee *errcode.Error
+	if errors.As(err, &ee) {
+		// 请求未能发出或结果读取失败（网络错误）
+		switch ee.Code() {
+		case errcode.Http_RequestError.Code(), errcode.Http_RespError.Code():
+			return errTransient
+		}
+		return errPermanent
+	}
+	var ne net.Error
+	switch {
+	case errors.Is(err, ErrChecksumMismatch),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.As(err, &ne):
+		return errTransient
+	}
+	return errPermanent
+}
+
+// 上传结果反馈，用于自适应并发控制
+type Feedback interface {
+	// 上传成功且耗时正常
+	Success()
+	// 限流或服务端错误
+	Overload(reason string)
+}
+
+var feedback Feedback
+
+// 设置上传结果反馈，需要在开始上传前调用
+func SetFeedback(f Feedback) {
+	feedback = f
+}
+
+// 按上传结果反馈：在请求超时的一半以内完成视为耗时正常，限流和临时错误视为过载
+func report(obj *Object, start time.Time, err error) {
+	if feedback == nil {
+		return
+	}
+	if err == nil {
+		if time.Since(start) <= transferTimeout(obj.Size)/2 {
+			feedback.Success()
+		}
+		return
+	}
+	if class := classifyError(err); class != errPermanent {
+		feedback.Overload(class.String() + ": " + err.Error())
+	}
+}
+
+// 重试延迟的随机抖动
+var jitter = struct {
+	sync.Mutex
+	*rand.Rand
+}{Rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// 解析 Retry-After（秒数或HTTP时间）
+func retryAfter(header http.Header) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// 第 attempt 次失败后的重试延迟：指数退避（Retry_Base_Delay * 2^(attempt-1)，不超过 Retry_Max_Delay）加随机抖动，
+// 服务端返回 Retry-After 时至少等待该时间
+func retryDelay(attempt int, err error) time.Duration {
+	base := seconds(global.ObjectSetting.OBJECT_Retry_Base_Delay, 2)
+	max := seconds(global.ObjectSetting.OBJECT_Retry_Max_Delay, 300)
+	delay := base
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	// 抖动：在 [delay/2, delay) 之间随机，避免同时失败的任务同时重试
+	jitter.Lock()
+	delay = delay/2 + time.Duration(jitter.Int63n(int64(delay/2)+1))
+	jitter.Unlock()
+	var be *BackendError
+	if errors.As(err, &be) && be.RetryAfter > delay {
+		delay = be.RetryAfter
+	}
+	return delay
+}
@@ -0,0 +1,268 @@
+package object
+
+import (
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/global"
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/errcode"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const BackendS3 = "s3"
+
+func init() {
+	RegisterBackend(BackendS3, func() (Backend, error) {
+		return newS3Backend()
+	})
+}
+
+// 直连S3兼容存储（MinIO、Ceph RGW等），请求使用 AWS Signature V4 签名
+type s3Backend struct {
+	endpoint  *url.URL
+	bucket    string
+	pathStyle bool
+	signer    *sigV4Signer
+	client    *http.Client
+}
+
+func newS3Backend() (*s3Backend, error) {
+	setting := global.ObjectSetting
+	if setting.S3_Endpoint == "" || setting.S3_Bucket == "" {
+		return nil, errors.New("S3_Endpoint 和 S3_Bucket 不能为空")
+	}
+	endpoint, err := url.Parse(setting.S3_Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, errors.New("S3_Endpoint 格式错误: " + setting.S3_Endpoint)
+	}
+	region := setting.S3_Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &s3Backend{
+		endpoint:  endpoint,
+		bucket:    setting.S3_Bucket,
+		pathStyle: setting.S3_PathStyle,
+		signer: &sigV4Signer{
+			accessKey: setting.S3_AccessKey,
+			secretKey: setting.S3_SecretKey,
+			region:    region,
+		},
+		client: httpClient(),
+	}, nil
+}
+
+func (b *s3Backend) Name() string {
+	return BackendS3
+}
+
+// 对象地址，path-style：endpoint/bucket/key，virtual-hosted-style：bucket.endpoint/key
+func (b *s3Backend) objectURL(key string, query url.Values) *url.URL {
+	u := *b.endpoint
+	path := strings.TrimSuffix(u.Path, "/")
+	if b.pathStyle {
+		path += "/" + b.bucket
+	} else {
+		u.Host = b.bucket + "." + u.Host
+	}
+	path += "/" + strings.TrimPrefix(key, "/")
+	u.Path = path
+	u.RawPath = uriEncodePath(path)
+	u.RawQuery = query.Encode()
+	return &u
+}
+
+// 发起签名请求，非2xx时解析S3错误信息并返回 BackendError
+func (b *s3Backend) do(ctx context.Context, method string, key string, query url.Values, body io.Reader, size int64, payloadHash string, header http.Header) (*http.Response, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, b.objectURL(key, query).String(), body)
+	if err != nil {
+		global.Logger.Error("http.NewRequest err", err)
+		return nil, errcode.Http_RequestError.Wrap(err)
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	b.signer.sign(req, payloadHash, time.Now())
+	resp, err := b.client.Do(req)
+	if err != nil {
+		global.Logger.Error("client.do err", err)
+		return nil, errcode.Http_RequestError.Wrap(err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		return nil, s3Error(resp)
+	}
+	return resp, nil
+}
+
+// S3错误返回
+type s3ErrorResponse struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+}
+
+func s3Error(resp *http.Response) error {
+	content, _ := io.ReadAll(resp.Body)
+	result := s3ErrorResponse{}
+	if err := xml.Unmarshal(content, &result); err != nil || result.Code == "" {
+		return &BackendError{Code: strconv.Itoa(resp.StatusCode), StatusCode: resp.StatusCode, Msg: resp.Status, RetryAfter: retryAfter(resp.Header)}
+	}
+	global.Logger.Error("S3返回错误: ", result.Code, " ", result.Message)
+	return &BackendError{Code: result.Code, StatusCode: resp.StatusCode, Msg: result.Message, RetryAfter: retryAfter(resp.Header)}
+}
+
+// 单次上传对象，不携带 Content-MD5（需要预先读取整个文件），由调用方比较返回的 ETag
+func (b *s3Backend) Put(ctx context.Context, obj *Object, body io.Reader, size int64) (string, error) {
+	header := http.Header{}
+	header.Set("Content-Type", "application/octet-stream")
+	resp, err := b.do(ctx, http.MethodPut, obj.FileKey, nil, body, size, unsignedPayload, header)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	return resp.Header.Get("ETag"), nil
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	UploadId string   `xml:"UploadId"`
+}
+
+// 1.初始化分段上传
+func (b *s3Backend) InitMultipart(ctx context.Context, obj *Object) (string, error) {
+	query := url.Values{}
+	query.Set("uploads", "")
+	header := http.Header{}
+	header.Set("Content-Type", "application/octet-stream")
+	resp, err := b.do(ctx, http.MethodPost, obj.FileKey, query, nil, 0, emptyPayload, header)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	result := initiateMultipartUploadResult{}
+	if err = xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", errcode.Http_RespError.Wrap(err)
+	}
+	if result.UploadId == "" {
+		return "", errcode.Http_RespError.WithDetails("uploadId为空")
+	}
+	return result.UploadId, nil
+}
+
+// 2.上传分段
+func (b *s3Backend) UploadPart(ctx context.Context, obj *Object, uploadid string, part Part) (global.FileResult, error) {
+	var result global.FileResult
+	query := url.Values{}
+	query.Set("partNumber", strconv.Itoa(part.Number))
+	query.Set("uploadId", uploadid)
+	resp, err := b.do(ctx, http.MethodPut, obj.FileKey, query, part.Body, part.Size, unsignedPayload, nil)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	result.PartNumber = part.Number
+	result.Etag = resp.Header.Get("ETag")
+	return result, nil
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+// 3.完成分段上传
+func (b *s3Backend) CompleteMultipart(ctx context.Context, obj *Object, uploadid string, parts []global.FileResult) error {
+	complete := completeMultipartUpload{}
+	for _, p := range parts {
+		complete.Parts = append(complete.Parts, completedPart{PartNumber: p.PartNumber, ETag: p.Etag})
+	}
+	content, err := xml.Marshal(complete)
+	if err != nil {
+		return err
+	}
+	query := url.Values{}
+	query.Set("uploadId", uploadid)
+	header := http.Header{}
+	header.Set("Content-Type", "application/xml")
+	resp, err := b.do(ctx, http.MethodPost, obj.FileKey, query, bytes.NewReader(content), int64(len(content)), hashHex(content), header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// 完成分段上传即使返回200，也可能在结果中包含错误
+	respContent, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errcode.Http_RespError.Wrap(err)
+	}
+	result := s3ErrorResponse{}
+	if xml.Unmarshal(respContent, &result) == nil && result.Code != "" {
+		return &BackendError{Code: result.Code, StatusCode: resp.StatusCode, Msg: result.Message, RetryAfter: retryAfter(resp.Header)}
+	}
+	return nil
+}
+
+// 取消分段上传
+func (b *s3Backend) AbortMultipart(ctx context.Context, obj *Object, uploadid string) error {
+	query := url.Values{}
+	query.Set("uploadId", uploadid)
+	resp, err := b.do(ctx, http.MethodDelete, obj.FileKey, query, nil, 0, emptyPayload, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// 查询对象
+func (b *s3Backend) Head(ctx context.Context, obj *Object) (*ObjectInfo, error) {
+	resp, err := b.do(ctx, http.MethodHead, obj.FileKey, nil, nil, 0, emptyPayload, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return headObjectInfo(resp)
+}
+
+// 删除对象
+func (b *s3Backend) Delete(ctx context.Context, obj *Object) error {
+	resp, err := b.do(ctx, http.MethodDelete, obj.FileKey, nil, nil, 0, emptyPayload, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// 从HEAD请求结果中解析对象信息
+func headObjectInfo(resp *http.Response) (*ObjectInfo, error) {
+	if resp.StatusCode != http.StatusOK {
+		return nil, &BackendError{Code: strconv.Itoa(resp.StatusCode), StatusCode: resp.StatusCode, Msg: resp.Status, RetryAfter: retryAfter(resp.Header)}
+	}
+	return &ObjectInfo{
+		Size: resp.ContentLength,
+		ETag: resp.Header.Get("ETag"),
+	}, nil
+}
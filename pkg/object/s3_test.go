@@ -0,0 +1,464 @@
+package object
+
+import (
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/global"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 分段大小（与 TestMain 中的 Each_Section_Size 一致）
+const testPartSize = 5 << 20
+
+// 测试用的S3兼容存储（path-style），按S3的规则计算 ETag：
+// 单次上传为内容MD5，分段上传完成后为各分段MD5拼接后的MD5加 -分段数
+type fakeS3 struct {
+	bucket  string
+	keep    bool // 保存对象内容，否则只记录大小和ETag（大文件测试）
+	badETag bool // 返回错误的ETag
+	slow    bool // 返回 503 SlowDown
+
+	mu      sync.Mutex
+	objects map[string]*fakeObject
+	uploads map[string]map[int]*fakeObject
+	nextId  int
+	aborted []string
+}
+
+type fakeObject struct {
+	data []byte
+	size int64
+	etag string
+}
+
+func newFakeS3(keep bool) *fakeS3 {
+	return &fakeS3{
+		bucket:  "dicom",
+		keep:    keep,
+		objects: make(map[string]*fakeObject),
+		uploads: make(map[string]map[int]*fakeObject),
+	}
+}
+
+func (s *fakeS3) error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+// 读取请求体并计算MD5，请求携带 Content-MD5 时校验
+func (s *fakeS3) readBody(w http.ResponseWriter, r *http.Request) (*fakeObject, bool) {
+	sum := md5.New()
+	var buf *bytes.Buffer
+	var dst io.Writer = sum
+	if s.keep {
+		buf = &bytes.Buffer{}
+		dst = io.MultiWriter(sum, buf)
+	}
+	n, err := io.Copy(dst, r.Body)
+	if err != nil {
+		s.error(w, http.StatusBadRequest, "IncompleteBody")
+		return nil, false
+	}
+	if r.ContentLength >= 0 && n != r.ContentLength {
+		s.error(w, http.StatusBadRequest, "IncompleteBody")
+		return nil, false
+	}
+	digest := sum.Sum(nil)
+	if want := r.Header.Get("Content-MD5"); want != "" && want != base64.StdEncoding.EncodeToString(digest) {
+		s.error(w, http.StatusBadRequest, "BadDigest")
+		return nil, false
+	}
+	obj := &fakeObject{size: n, etag: hex.EncodeToString(digest)}
+	if buf != nil {
+		obj.data = buf.Bytes()
+	}
+	return obj, true
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), sigV4Algorithm+" Credential=") || r.Header.Get("X-Amz-Date") == "" {
+		s.error(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+	if s.slow {
+		s.error(w, http.StatusServiceUnavailable, "SlowDown")
+		return
+	}
+	prefix := "/" + s.bucket + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		s.error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, prefix)
+	query := r.URL.Query()
+	_, initiate := query["uploads"]
+	uploadId := query.Get("uploadId")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPost && initiate:
+		s.nextId++
+		id := "upload-" + strconv.Itoa(s.nextId)
+		s.uploads[id] = make(map[int]*fakeObject)
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>", s.bucket, key, id)
+	case r.Method == http.MethodPut && uploadId != "":
+		parts, ok := s.uploads[uploadId]
+		if !ok {
+			s.error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		number, err := strconv.Atoi(query.Get("partNumber"))
+		if err != nil || number < 1 {
+			s.error(w, http.StatusBadRequest, "InvalidArgument")
+			return
+		}
+		part, ok := s.readBody(w, r)
+		if !ok {
+			return
+		}
+		parts[number] = part
+		w.Header().Set("ETag", s.etag(part.etag))
+	case r.Method == http.MethodPost && uploadId != "":
+		parts, ok := s.uploads[uploadId]
+		if !ok {
+			s.error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		complete := completeMultipartUpload{}
+		if err := xml.NewDecoder(r.Body).Decode(&complete); err != nil || len(complete.Parts) == 0 {
+			s.error(w, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+		obj := &fakeObject{}
+		sum := md5.New()
+		for i, p := range complete.Parts {
+			part, ok := parts[p.PartNumber]
+			if !ok || strings.Trim(p.ETag, `"`) != part.etag {
+				s.error(w, http.StatusBadRequest, "InvalidPart")
+				return
+			}
+			if i > 0 && p.PartNumber <= complete.Parts[i-1].PartNumber {
+				s.error(w, http.StatusBadRequest, "InvalidPartOrder")
+				return
+			}
+			digest, _ := hex.DecodeString(part.etag)
+			sum.Write(digest)
+			obj.size += part.size
+			obj.data = append(obj.data, part.data...)
+		}
+		obj.etag = hex.EncodeToString(sum.Sum(nil)) + "-" + strconv.Itoa(len(complete.Parts))
+		s.objects[key] = obj
+		delete(s.uploads, uploadId)
+		fmt.Fprintf(w, "<CompleteMultipartUploadResult><Key>%s</Key><ETag>%s</ETag></CompleteMultipartUploadResult>", key, s.etag(obj.etag))
+	case r.Method == http.MethodDelete && uploadId != "":
+		if _, ok := s.uploads[uploadId]; !ok {
+			s.error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		delete(s.uploads, uploadId)
+		s.aborted = append(s.aborted, uploadId)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		obj, ok := s.readBody(w, r)
+		if !ok {
+			return
+		}
+		s.objects[key] = obj
+		w.Header().Set("ETag", s.etag(obj.etag))
+	case r.Method == http.MethodHead:
+		obj, ok := s.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(obj.size, 10))
+		w.Header().Set("ETag", s.etag(obj.etag))
+	case r.Method == http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s.error(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func (s *fakeS3) etag(etag string) string {
+	if s.badETag {
+		etag = strings.Repeat("0", md5.Size*2)
+	}
+	return `"` + etag + `"`
+}
+
+func (s *fakeS3) object(key string) *fakeObject {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.objects[key]
+}
+
+// 连接测试服务的S3后端
+func newTestS3Backend(t testing.TB, srv *httptest.Server, fake *fakeS3) *s3Backend {
+	endpoint, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &s3Backend{
+		endpoint:  endpoint,
+		bucket:    fake.bucket,
+		pathStyle: true,
+		signer:    &sigV4Signer{accessKey: "test", secretKey: "test", region: "us-east-1"},
+		client:    srv.Client(),
+	}
+}
+
+// 生成随机内容的测试文件
+func writeTestFile(t testing.TB, size int) (string, []byte) {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(data)
+	path := filepath.Join(t.TempDir(), "test.dcm")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path, data
+}
+
+func TestS3Put(t *testing.T) {
+	fake := newFakeS3(true)
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	backend := newTestS3Backend(t, srv, fake)
+
+	path, data := writeTestFile(t, 100<<10)
+	obj := &Object{Key: 1, FileKey: "2026/1.dcm", FilePath: path}
+	if err := UploadFile(context.Background(), backend, obj); err != nil {
+		t.Fatal(err)
+	}
+	remote := fake.object(obj.FileKey)
+	if remote == nil || !bytes.Equal(remote.data, data) {
+		t.Fatal("远端对象内容与本地文件不一致")
+	}
+	if obj.Size != int64(len(data)) || obj.Checksum.MD5 != remote.etag {
+		t.Errorf("Size/MD5 = %d/%s, want %d/%s", obj.Size, obj.Checksum.MD5, len(data), remote.etag)
+	}
+	if err := VerifyRemote(context.Background(), backend, obj); err != nil {
+		t.Errorf("VerifyRemote: %v", err)
+	}
+}
+
+func TestS3PutETagMismatch(t *testing.T) {
+	fake := newFakeS3(false)
+	fake.badETag = true
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	backend := newTestS3Backend(t, srv, fake)
+
+	path, _ := writeTestFile(t, 10<<10)
+	obj := &Object{Key: 1, FileKey: "2026/1.dcm", FilePath: path}
+	if err := UploadFile(context.Background(), backend, obj); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("UploadFile err = %v, want ErrChecksumMismatch", err)
+	}
+}
+
+func TestS3Multipart(t *testing.T) {
+	fake := newFakeS3(true)
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	backend := newTestS3Backend(t, srv, fake)
+
+	// 5MB分段，最后一段不满
+	size := 2*testPartSize + 123
+	path, data := writeTestFile(t, size)
+	obj := &Object{Key: 2, FileKey: "2026/2.dcm", FilePath: path}
+	if err := UploadLargeFile(context.Background(), backend, obj, int64(size)); err != nil {
+		t.Fatal(err)
+	}
+	remote := fake.object(obj.FileKey)
+	if remote == nil || !bytes.Equal(remote.data, data) {
+		t.Fatal("远端对象内容与本地文件不一致")
+	}
+	if !strings.HasSuffix(remote.etag, "-3") {
+		t.Errorf("远端ETag = %s, want 3个分段", remote.etag)
+	}
+	// 组合校验和与S3分段ETag算法一致
+	if obj.Checksum.MD5 != remote.etag {
+		t.Errorf("组合MD5 = %s, want %s", obj.Checksum.MD5, remote.etag)
+	}
+	if !strings.HasSuffix(obj.Checksum.PartSHA256, "-3") || len(obj.Checksum.PartSHA256) != 66 || obj.Checksum.PartSize != testPartSize {
+		t.Errorf("组合SHA256 = %s, 分段大小 = %d", obj.Checksum.PartSHA256, obj.Checksum.PartSize)
+	}
+	// 并发上传时可能无法按顺序计算整个文件的SHA-256，计算出的值必须是真实的SHA-256
+	if sum := sha256.Sum256(data); obj.Checksum.SHA256 != "" && obj.Checksum.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("SHA256 = %s, want %x", obj.Checksum.SHA256, sum)
+	}
+	if err := VerifyRemote(context.Background(), backend, obj); err != nil {
+		t.Errorf("VerifyRemote: %v", err)
+	}
+	if _, err := os.Stat(journalPath(obj.Key, obj.Type)); !os.IsNotExist(err) {
+		t.Errorf("完成后断点记录未删除: %v", err)
+	}
+	if len(fake.uploads) != 0 {
+		t.Errorf("存在未完成的分段上传: %d", len(fake.uploads))
+	}
+}
+
+// 串行上传分段时按顺序计算整个文件的SHA-256
+func TestS3MultipartSerialSHA256(t *testing.T) {
+	old := global.ObjectSetting
+	defer func() { global.ObjectSetting = old }()
+	setting := *old
+	setting.Multipart_Concurrency = 1
+	global.ObjectSetting = &setting
+
+	fake := newFakeS3(false)
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	backend := newTestS3Backend(t, srv, fake)
+
+	size := 2*testPartSize + 7
+	path, data := writeTestFile(t, size)
+	obj := &Object{Key: 6, FileKey: "2026/6.dcm", FilePath: path}
+	if err := UploadLargeFile(context.Background(), backend, obj, int64(size)); err != nil {
+		t.Fatal(err)
+	}
+	if sum := sha256.Sum256(data); obj.Checksum.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("SHA256 = %s, want %x", obj.Checksum.SHA256, sum)
+	}
+}
+
+func TestS3MultipartVerifyMismatch(t *testing.T) {
+	fake := newFakeS3(false)
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	backend := newTestS3Backend(t, srv, fake)
+
+	size := testPartSize + 1
+	path, _ := writeTestFile(t, size)
+	obj := &Object{Key: 3, FileKey: "2026/3.dcm", FilePath: path}
+	if err := UploadLargeFile(context.Background(), backend, obj, int64(size)); err != nil {
+		t.Fatal(err)
+	}
+	// 远端对象被其他内容覆盖
+	fake.mu.Lock()
+	fake.objects[obj.FileKey].etag = strings.Repeat("1", md5.Size*2) + "-2"
+	fake.mu.Unlock()
+	if err := VerifyRemote(context.Background(), backend, obj); !errors.Is(err, ErrVerifyFailed) {
+		t.Errorf("VerifyRemote err = %v, want ErrVerifyFailed", err)
+	}
+}
+
+func TestS3AbortMultipart(t *testing.T) {
+	fake := newFakeS3(false)
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	backend := newTestS3Backend(t, srv, fake)
+
+	ctx := context.Background()
+	obj := &Object{Key: 4, FileKey: "2026/4.dcm"}
+	uploadId, err := backend.InitMultipart(ctx, obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part := Part{Number: 1, Size: 3, Body: strings.NewReader("abc")}
+	result, err := backend.UploadPart(ctx, obj, uploadId, part)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := md5.Sum([]byte("abc"))
+	if !etagMatches(result.Etag, hex.EncodeToString(sum[:])) || result.PartNumber != 1 {
+		t.Errorf("UploadPart = %+v", result)
+	}
+	if err = backend.AbortMultipart(ctx, obj, uploadId); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.aborted) != 1 || fake.aborted[0] != uploadId {
+		t.Errorf("aborted = %v, want [%s]", fake.aborted, uploadId)
+	}
+	// 已取消的上传不能完成
+	err = backend.CompleteMultipart(ctx, obj, uploadId, []global.FileResult{result})
+	var be *BackendError
+	if !errors.As(err, &be) || be.Code != "NoSuchUpload" || be.StatusCode != http.StatusNotFound {
+		t.Errorf("CompleteMultipart err = %v, want NoSuchUpload", err)
+	}
+}
+
+func TestS3ErrorResponse(t *testing.T) {
+	fake := newFakeS3(false)
+	fake.slow = true
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	backend := newTestS3Backend(t, srv, fake)
+
+	obj := &Object{Key: 5, FileKey: "2026/5.dcm"}
+	_, err := backend.Put(context.Background(), obj, strings.NewReader("abc"), 3)
+	var be *BackendError
+	if !errors.As(err, &be) || be.Code != "SlowDown" || be.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Put err = %v, want SlowDown", err)
+	}
+	if classifyError(err) != errThrottled {
+		t.Errorf("classifyError = %v, want errThrottled", classifyError(err))
+	}
+	if _, err = backend.Head(context.Background(), obj); err == nil {
+		t.Error("Head 应返回错误")
+	}
+}
+
+// 统计读取的字节数，支持 Seek 以便检查后端是否预先读取
+type countingReader struct {
+	*bytes.Reader
+	read int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.read += int64(n)
+	return n, err
+}
+
+// 源文件只读取一次：不预先读取请求体计算 Content-MD5
+func TestS3ReadsBodyOnce(t *testing.T) {
+	fake := newFakeS3(false)
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	backend := newTestS3Backend(t, srv, fake)
+
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("dicom"), 1<<10)
+	obj := &Object{Key: 7, FileKey: "2026/7.dcm"}
+	body := &countingReader{Reader: bytes.NewReader(data)}
+	if _, err := backend.Put(ctx, obj, body, int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	if body.read != int64(len(data)) {
+		t.Errorf("Put 读取 %d 字节, want %d", body.read, len(data))
+	}
+
+	uploadId, err := backend.InitMultipart(ctx, obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body = &countingReader{Reader: bytes.NewReader(data)}
+	part := Part{Number: 1, Size: int64(len(data)), Last: true, Body: body}
+	if _, err = backend.UploadPart(ctx, obj, uploadId, part); err != nil {
+		t.Fatal(err)
+	}
+	if body.read != int64(len(data)) {
+		t.Errorf("UploadPart 读取 %d 字节, want %d", body.read, len(data))
+	}
+}
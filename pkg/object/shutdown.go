@@ -0,0 +1,89 @@
+package object
+
+import (
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/global"
+	"context"
+	"sync"
+	"time"
+)
+
+// 正在进行的分段上传
+type multipartUpload struct {
+	backend     Backend
+	obj         *Object
+	uploadId    string
+	interrupted bool // 因停止服务中断，在 done 关闭后读取
+	done        chan struct{}
+}
+
+var activeUploads = struct {
+	sync.Mutex
+	m map[*multipartUpload]struct{}
+}{m: make(map[*multipartUpload]struct{})}
+
+func startMultipart(backend Backend, obj *Object, uploadid string) *multipartUpload {
+	u := &multipartUpload{
+		backend:  backend,
+		obj:      obj,
+		uploadId: uploadid,
+		done:     make(chan struct{}),
+	}
+	activeUploads.Lock()
+	activeUploads.m[u] = struct{}{}
+	activeUploads.Unlock()
+	return u
+}
+
+// 上传结束：因停止服务中断的上传保留在记录中，由 Shutdown 处理
+// （工作池取消任务后、Shutdown 获取记录前结束的上传也不会遗漏）
+func (u *multipartUpload) finish() {
+	activeUploads.Lock()
+	if !u.interrupted {
+		delete(activeUploads.m, u)
+	}
+	activeUploads.Unlock()
+	close(u.done)
+}
+
+// 停止服务：等待工作池取消的分段上传结束
+// 开启 Multipart_Abort_On_Shutdown 时取消中断的分段上传并删除断点记录，否则保留断点记录供重启后续传
+func Shutdown(wait time.Duration) {
+	activeUploads.Lock()
+	uploads := make([]*multipartUpload, 0, len(activeUploads.m))
+	for u := range activeUploads.m {
+		uploads = append(uploads, u)
+	}
+	activeUploads.Unlock()
+
+	// 所有上传共用一个等待期限，超时后不再等待剩余的上传
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	expired := false
+	for _, u := range uploads {
+		if !expired {
+			select {
+			case <-u.done:
+			case <-timer.C:
+				expired = true
+			}
+		}
+		select {
+		case <-u.done:
+			if !u.interrupted {
+				continue
+			}
+		default:
+			global.Logger.Warn("等待分段上传中断超时: ", u.obj.Key, " UploadId: ", u.uploadId)
+		}
+		activeUploads.Lock()
+		delete(activeUploads.m, u)
+		activeUploads.Unlock()
+		if !global.ObjectSetting.Multipart_Abort_On_Shutdown {
+			global.Logger.Info("保留分段上传断点记录，重启后续传: ", u.obj.Key, " UploadId: ", u.uploadId)
+			continue
+		}
+		global.Logger.Info("停止服务，取消未完成的分段上传: ", u.obj.Key, " UploadId: ", u.uploadId)
+		abortMultipart(context.Background(), u.backend, u.obj, u.uploadId)
+		removeJournal(u.obj)
+	}
+}
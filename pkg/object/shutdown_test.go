@@ -0,0 +1,61 @@
+package object
+
+import (
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/global"
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// 等待期限对所有上传共用，多个上传未结束时也不会一直等待
+func TestShutdownSharedDeadline(t *testing.T) {
+	old := global.ObjectSetting
+	defer func() { global.ObjectSetting = old }()
+	setting := *old
+	setting.Multipart_Abort_On_Shutdown = true
+	global.ObjectSetting = &setting
+
+	fake := newFakeS3(false)
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	backend := newTestS3Backend(t, srv, fake)
+
+	ctx := context.Background()
+	var stuck []*multipartUpload
+	for i := 0; i < 3; i++ {
+		obj := &Object{Key: int64(20 + i), FileKey: "2026/stuck.dcm"}
+		uploadId, err := backend.InitMultipart(ctx, obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stuck = append(stuck, startMultipart(backend, obj, uploadId))
+	}
+	// 已中断结束的上传
+	obj := &Object{Key: 30, FileKey: "2026/interrupted.dcm"}
+	uploadId, err := backend.InitMultipart(ctx, obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	interrupted := startMultipart(backend, obj, uploadId)
+	interrupted.interrupted = true
+	interrupted.finish()
+
+	start := time.Now()
+	Shutdown(100 * time.Millisecond)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Shutdown 耗时 %v, 超过等待期限", elapsed)
+	}
+	if len(fake.aborted) != 4 {
+		t.Errorf("aborted = %v, want 4个分段上传", fake.aborted)
+	}
+	activeUploads.Lock()
+	remaining := len(activeUploads.m)
+	activeUploads.Unlock()
+	if remaining != 0 {
+		t.Errorf("Shutdown 后仍有 %d 个分段上传记录", remaining)
+	}
+	for _, u := range stuck {
+		u.finish()
+	}
+}
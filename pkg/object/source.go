@@ -0,0 +1,130 @@
+package object
+
+import (
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/global"
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/bandwidth"
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/metrics"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// 源文件所在主机（study_location ip）的并发和读取速率限制
+// 同一主机上同时读取的文件数不超过 MaxConcurrency，读取速率不超过 ReadRate，
+// 避免大量worker同时读取同一台老旧的NAS
+type sourceHost struct {
+	name    string
+	sem     chan struct{} // 为空时不限制并发
+	limiter *bandwidth.Limiter
+}
+
+var sourceHosts = struct {
+	sync.Mutex
+	m map[string]*sourceHost
+}{m: make(map[string]*sourceHost)}
+
+// 本地路径（非UNC路径）统一作为一个主机
+const localHost = "local"
+
+// 从文件路径（\\ip\s_virtual_dir\file）中取出主机
+func sourceHostName(path string) string {
+	if !strings.HasPrefix(path, `\\`) {
+		return localHost
+	}
+	host := path[2:]
+	if i := strings.IndexAny(host, `\/`); i >= 0 {
+		host = host[:i]
+	}
+	return strings.ToLower(host)
+}
+
+// 从UNC路径（\\ip\s_virtual_dir\file）中取出共享根目录 \\ip\s_virtual_dir\，本地路径返回空
+func sourceShareRoot(path string) string {
+	if !strings.HasPrefix(path, `\\`) {
+		return ""
+	}
+	rest := path[2:]
+	i := strings.IndexAny(rest, `\/`)
+	if i < 0 {
+		return ""
+	}
+	share := rest[i+1:]
+	if j := strings.IndexAny(share, `\/`); j >= 0 {
+		share = share[:j]
+	}
+	if share == "" {
+		return ""
+	}
+	return `\\` + rest[:i] + `\` + share + `\`
+}
+
+// 确认源文件所在的共享目录可以访问
+// 主机不可达（ERROR_BAD_NETPATH）或共享不存在时 os.IsNotExist 同样成立，只有共享根目录可以访问时才能判断源文件不存在
+func sourceReachable(path string) error {
+	root := sourceShareRoot(path)
+	if root == "" {
+		return nil
+	}
+	_, err := os.Stat(root)
+	return err
+}
+
+// 获取主机的限制，第一次使用时按配置创建，没有单独配置的主机使用默认值
+func getSourceHost(name string) *sourceHost {
+	sourceHosts.Lock()
+	defer sourceHosts.Unlock()
+	if host, ok := sourceHosts.m[name]; ok {
+		return host
+	}
+	concurrency, rate := 0, 0.0
+	if s := global.SourceHostSetting; s != nil {
+		concurrency, rate = s.MaxConcurrency, s.ReadRate
+		for _, h := range s.Hosts {
+			if strings.EqualFold(h.Ip, name) {
+				concurrency, rate = h.MaxConcurrency, h.ReadRate
+				break
+			}
+		}
+	}
+	host := &sourceHost{name: name, limiter: bandwidth.NewLimiter()}
+	if concurrency > 0 {
+		host.sem = make(chan struct{}, concurrency)
+	}
+	if err := host.limiter.SetSchedule(rate, nil); err != nil {
+		global.Logger.Error("源文件主机读取速率配置有误，不限制读取速率: ", name, " err: ", err)
+	}
+	sourceHosts.m[name] = host
+	return host
+}
+
+// 打开源文件前获取主机的读取许可，超过并发上限时等待，ctx 取消时返回错误
+func acquireSource(ctx context.Context, path string) (*sourceHost, error) {
+	host := getSourceHost(sourceHostName(path))
+	if host.sem != nil {
+		select {
+		case host.sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	metrics.SourceHostReads.WithLabelValues(host.name).Inc()
+	return host, nil
+}
+
+// 释放读取许可
+func (h *sourceHost) release() {
+	metrics.SourceHostReads.WithLabelValues(h.name).Dec()
+	if h.sem != nil {
+		<-h.sem
+	}
+}
+
+// 按主机读取速率限速读取源文件，未获取许可时不限速
+func (h *sourceHost) reader(ctx context.Context, r io.Reader) io.Reader {
+	if h == nil {
+		return r
+	}
+	return bandwidth.NewReader(ctx, r, h.limiter)
+}
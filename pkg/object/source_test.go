@@ -0,0 +1,36 @@
+package object
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSourceShareRoot(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{`\\192.168.1.10\dicom\2026\10\1.dcm`, `\\192.168.1.10\dicom\`},
+		{`\\nas/dicom/1.dcm`, `\\nas\dicom\`},
+		{`\\nas\dicom`, `\\nas\dicom\`},
+		{`\\nas`, ``},
+		{`\\nas\`, ``},
+		{`D:\dicom\1.dcm`, ``},
+		{`/data/dicom/1.dcm`, ``},
+	}
+	for _, tt := range tests {
+		if got := sourceShareRoot(tt.path); got != tt.want {
+			t.Errorf("sourceShareRoot(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+// 共享目录无法访问时不能判断源文件不存在，本地路径不检查
+func TestSourceReachable(t *testing.T) {
+	if err := sourceReachable(filepath.Join(t.TempDir(), "missing.dcm")); err != nil {
+		t.Errorf("本地路径 err = %v, want nil", err)
+	}
+	if err := sourceReachable(`\\unreachable-host\dicom\1.dcm`); err == nil {
+		t.Error("无法访问的共享目录 err = nil")
+	}
+}
@@ -0,0 +1,39 @@
+package object
+
+import (
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/global"
+	"context"
+	"io"
+	"time"
+)
+
+// 普通请求（初始化、完成、取消、查询、获取临时地址）超时
+func requestTimeout() time.Duration {
+	timeout := time.Duration(global.ObjectSetting.OBJECT_Request_Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	return timeout
+}
+
+// 传输请求超时：基础超时加上按最低传输速率传完 size 字节所需的时间，大文件不会因固定超时被中断
+func transferTimeout(size int64) time.Duration {
+	rate := int64(global.ObjectSetting.OBJECT_Min_Transfer_Rate) << 10
+	if rate <= 0 {
+		rate = 256 << 10
+	}
+	return requestTimeout() + time.Duration(size/rate)*time.Second
+}
+
+// context 取消后停止读取，用于不支持 context 的写入（如本地文件）
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,57 @@
+package object
+
+import (
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/global"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// 按配置生成所有对外请求使用的TLS配置
+// 默认校验服务端证书，只有明确开启 TLS_Insecure_Skip_Verify 时才跳过校验
+func newTLSConfig() (*tls.Config, error) {
+	setting := global.ObjectSetting
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if setting.TLS_Min_Version != "" {
+		version, ok := tlsVersions[setting.TLS_Min_Version]
+		if !ok {
+			return nil, fmt.Errorf("不支持的TLS版本: %s", setting.TLS_Min_Version)
+		}
+		config.MinVersion = version
+	}
+	if setting.TLS_CA_File != "" {
+		content, err := os.ReadFile(setting.TLS_CA_File)
+		if err != nil {
+			return nil, fmt.Errorf("读取CA证书失败: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(content) {
+			return nil, errors.New("CA证书文件中没有有效的证书: " + setting.TLS_CA_File)
+		}
+		config.RootCAs = pool
+	}
+	if setting.TLS_Cert_File != "" || setting.TLS_Key_File != "" {
+		if setting.TLS_Cert_File == "" || setting.TLS_Key_File == "" {
+			return nil, errors.New("TLS_Cert_File 和 TLS_Key_File 需要同时配置")
+		}
+		cert, err := tls.LoadX509KeyPair(setting.TLS_Cert_File, setting.TLS_Key_File)
+		if err != nil {
+			return nil, fmt.Errorf("读取客户端证书失败: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if setting.TLS_Insecure_Skip_Verify {
+		global.Logger.Warn("***已开启 TLS_Insecure_Skip_Verify，不校验服务端证书***")
+		config.InsecureSkipVerify = true
+	}
+	return config, nil
+}
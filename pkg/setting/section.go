@@ -4,7 +4,9 @@ import "time"
 
 type ServerSettingS struct {
 	RunMode      string
+	HttpAddr     string // 管理接口监听地址，为空时只监听本机（127.0.0.1）
 	HttpPort     string
+	AdminToken   string // 管理接口鉴权 Token，不为空时 /api/v1 接口需要携带请求头 Authorization: Bearer <AdminToken>
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
 }
@@ -18,6 +20,22 @@ type GeneralSettingS struct {
 	MaxThreads  int
 	MaxTasks    int
 	CronSpec    string
+	// 停止服务时等待任务完成的时间（秒）
+	ShutdownTimeout int
+	// 自适应并发控制
+	AdaptiveLimit      bool
+	AdaptiveMinThreads int
+	AdaptiveDecrease   float64
+	AdaptiveCooldown   int
+	// 多实例认领数据：认领者标识（默认主机名）和租约时长（秒）
+	ClaimOwner string
+	ClaimLease int
+	// 上传失败数据定时重试
+	RetrySweepSpec      string
+	RetrySweepBaseDelay int
+	RetrySweepMaxDelay  int
+	RetrySweepMax       int
+	RetrySweepBatch     int
 }
 
 type DatabaseSettingS struct {
@@ -26,6 +44,8 @@ type DatabaseSettingS struct {
 	MaxIdleConns int
 	MaxOpenConns int
 	MaxLifetime  int
+	// 单次查询/更新超时（秒）
+	QueryTimeout int
 }
 
 type ObjectSettingS struct {
@@ -35,19 +55,80 @@ type ObjectSettingS struct {
 	UPLOAD_ROOT                     string
 	OBJECT_Upload_Success_Code      int
 	OBJECT_Count                    int
+	OBJECT_Retry_Base_Delay         int
+	OBJECT_Retry_Max_Delay          int
 	OBJECT_Store_Type               int
 	OBJECT_TIME                     int
 	File_Fragment_Size              int
 	Each_Section_Size               int
-	File_Split_Temp                 string
+	Multipart_Concurrency           int
+	Multipart_Journal_Dir           string
+	Multipart_Journal_Expire        int
+	Multipart_Abort_On_Shutdown     bool
+	OBJECT_Request_Timeout          int
+	OBJECT_Min_Transfer_Rate        int
 	OBJECT_Multipart_Init_URL       string
 	OBJECT_Multipart_Upload_URL     string
 	OBJECT_Multipart_Completion_URL string
 	OBJECT_Multipart_Abortion_URL   string
 	OBJECT_Interface_Type           int
+	OBJECT_Backend                  string
+	OBJECT_Checksum_Verify          bool
+	OBJECT_Verify_Remote            bool
+	S3_Endpoint                     string
+	S3_Region                       string
+	S3_AccessKey                    string
+	S3_SecretKey                    string
+	S3_Bucket                       string
+	S3_PathStyle                    bool
+	FS_Root                         string
+	HTTP_Max_Idle_Conns             int
+	HTTP_Max_Idle_Conns_Per_Host    int
+	HTTP_Max_Conns_Per_Host         int
+	HTTP_Idle_Conn_Timeout          int
+	HTTP_Keep_Alive                 int
+	HTTP_Disable_Keep_Alives        bool
+	HTTP_Connect_Timeout            int
+	HTTP_TLS_Handshake_Timeout      int
+	HTTP_Response_Header_Timeout    int
+	HTTP_Proxy                      string
+	TLS_CA_File                     string
+	TLS_Cert_File                   string
+	TLS_Key_File                    string
+	TLS_Min_Version                 string
+	TLS_Insecure_Skip_Verify        bool
 	OBJECT_Temp_GET_Upload          string
 	OBJECT_START_KEY                int64
+	OBJECT_Key_Order                string
+	OBJECT_Cursor_File              string
 	UploadImgFlag                   string
+	JPG_Upload_Enable               bool
+	JPG_MaxTasks                    int
+}
+
+// 上传带宽限制，修改后无需重启即可生效
+type BandwidthSettingS struct {
+	Default  float64
+	Schedule []BandwidthRuleS
+}
+
+type BandwidthRuleS struct {
+	Start string
+	End   string
+	Rate  float64
+}
+
+// 源文件所在主机（study_location ip）的读取限制，没有单独配置的主机使用默认值
+type SourceHostSettingS struct {
+	MaxConcurrency int
+	ReadRate       float64
+	Hosts          []SourceHostRuleS
+}
+
+type SourceHostRuleS struct {
+	Ip             string
+	MaxConcurrency int
+	ReadRate       float64
 }
 
 func (s *Setting) ReadSection(k string, v interface{}) error {
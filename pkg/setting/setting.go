@@ -2,7 +2,10 @@ package setting
 
 // 配置文件
 
-import "github.com/spf13/viper"
+import (
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
 
 type Setting struct {
 	vp *viper.Viper
@@ -19,3 +22,11 @@ func NewSetting() (*Setting, error) {
 	}
 	return &Setting{vp: vp}, nil
 }
+
+// 监听配置文件修改，修改后调用 fn
+func (s *Setting) WatchSettingChange(fn func()) {
+	s.vp.OnConfigChange(func(in fsnotify.Event) {
+		fn()
+	})
+	s.vp.WatchConfig()
+}
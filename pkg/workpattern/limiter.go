@@ -0,0 +1,125 @@
+package workpattern
+
+import (
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/global"
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/metrics"
+	"context"
+	"sync"
+	"time"
+)
+
+// AIMD 并发控制
+// 上传成功且耗时正常时缓慢增加并发上限（每完成 limit 个任务加一），
+// 出现限流或服务端错误时按比例降低并发上限，冷却时间内只降低一次，避免同一批失败把上限一直压到最低
+type AIMDLimiter struct {
+	mu           sync.Mutex
+	limit        float64
+	min          int
+	max          int
+	factor       float64
+	cooldown     time.Duration
+	lastDecrease time.Time
+	inflight     int
+	// 上限提高或有任务完成时通知等待的任务
+	changed chan struct{}
+}
+
+func NewAIMDLimiter(min, max int, factor float64, cooldown time.Duration) *AIMDLimiter {
+	if max < 1 {
+		max = 1
+	}
+	if min < 1 || min > max {
+		min = 1
+	}
+	if factor <= 0 || factor >= 1 {
+		factor = 0.5
+	}
+	l := &AIMDLimiter{
+		limit:    float64(max),
+		min:      min,
+		max:      max,
+		factor:   factor,
+		cooldown: cooldown,
+		changed:  make(chan struct{}),
+	}
+	metrics.ConcurrencyLimit.WithLabelValues().Set(float64(max))
+	return l
+}
+
+// 通知等待的任务，调用时需持有锁
+func (l *AIMDLimiter) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// 等待执行许可，ctx 取消时返回false
+func (l *AIMDLimiter) Acquire(ctx context.Context) bool {
+	for {
+		l.mu.Lock()
+		if l.inflight < int(l.limit) {
+			l.inflight++
+			l.mu.Unlock()
+			return true
+		}
+		changed := l.changed
+		l.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// 释放执行许可
+func (l *AIMDLimiter) Release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inflight--
+	l.notify()
+}
+
+// 任务成功且耗时正常：加性增加
+func (l *AIMDLimiter) Success() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if int(l.limit) >= l.max {
+		return
+	}
+	old := int(l.limit)
+	l.limit += 1 / l.limit
+	if l.limit > float64(l.max) {
+		l.limit = float64(l.max)
+	}
+	if int(l.limit) != old {
+		global.Logger.Info("并发上限提高: ", old, " -> ", int(l.limit))
+		metrics.ConcurrencyLimit.WithLabelValues().Set(float64(int(l.limit)))
+		l.notify()
+	}
+}
+
+// 限流或服务端错误：乘性减少
+func (l *AIMDLimiter) Overload(reason string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if time.Since(l.lastDecrease) < l.cooldown {
+		return
+	}
+	l.lastDecrease = time.Now()
+	old := int(l.limit)
+	l.limit *= l.factor
+	if l.limit < float64(l.min) {
+		l.limit = float64(l.min)
+	}
+	if int(l.limit) != old {
+		global.Logger.Warn("并发上限降低: ", old, " -> ", int(l.limit), " 原因: ", reason)
+		metrics.ConcurrencyLimit.WithLabelValues().Set(float64(int(l.limit)))
+	}
+}
+
+// 当前并发上限
+func (l *AIMDLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
@@ -1,8 +1,17 @@
 package workpattern
 
+import (
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/metrics"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
 // 任务
+// ctx 在线程池停止且等待超时后取消
 type Job interface {
-	Do()
+	Do(ctx context.Context)
 }
 
 // worker 工人
@@ -29,7 +38,7 @@ func NewWorker() Worker {
 当工作池中没有可用的worker(工人)时，就会阻塞等待一个空闲的worker(工人)。
 每读到一个通道参数 运行一个 worker
 */
-func (w Worker) Run(wq chan chan Job) {
+func (w Worker) Run(ctx context.Context, wq chan chan Job) {
 	// 这是一个独立的协程，循环读取通道内的数据
 	// 保存每读取一个通道参数就去工作，没有读到就阻塞
 	go func() {
@@ -39,7 +48,7 @@ func (w Worker) Run(wq chan chan Job) {
 			select {
 			// 获取任务
 			case job := <-w.JobQueue:
-				job.Do()
+				job.Do(ctx)
 			// 终止当前任务
 			case <-w.Quit:
 				return
@@ -55,10 +64,47 @@ type WorkerPool struct {
 	// 线程池的job通道
 	JobQueue    chan Job
 	WorkerQueue chan chan Job
+	// 已提交但还未分配给worker的任务数
+	queued int64
+	// 正在执行任务的worker数
+	busy int64
+	// 已提交但还未执行完成的任务
+	pending sync.WaitGroup
+	mu      sync.Mutex
+	closed  bool
+	// 取消正在执行的任务
+	ctx    context.Context
+	cancel context.CancelFunc
+	// 并发控制，为空时并发数为worker数量
+	limiter *AIMDLimiter
+}
+
+// 记录执行状态的任务
+type countedJob struct {
+	job Job
+	wp  *WorkerPool
+}
+
+func (c countedJob) Do(ctx context.Context) {
+	atomic.AddInt64(&c.wp.busy, 1)
+	metrics.PoolBusy.WithLabelValues().Inc()
+	defer func() {
+		atomic.AddInt64(&c.wp.busy, -1)
+		metrics.PoolBusy.WithLabelValues().Dec()
+		metrics.PoolJobs.WithLabelValues().Inc()
+		if c.wp.limiter != nil {
+			c.wp.limiter.Release()
+		}
+		c.wp.pending.Done()
+	}()
+	c.job.Do(ctx)
 }
 
 func NewWorkerPool(workerlen int) *WorkerPool {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &WorkerPool{
+		ctx:    ctx,
+		cancel: cancel,
 		// 开始建立 workerlen 个worker(工人)协程
 		workerlen: workerlen,
 		// 工作队列通道
@@ -70,12 +116,13 @@ func NewWorkerPool(workerlen int) *WorkerPool {
 
 // 运行线程池
 func (wp *WorkerPool) Run() {
+	metrics.PoolWorkers.WithLabelValues().Set(float64(wp.workerlen))
 	//初始化时会按照传入的num，启动num个后台协程，然后循环读取Job通道里面的数据，
 	//读到一个数据时，再获取一个可用的Worker，并将Job对象传递到该Worker的chan通道
 	for i := 0; i < wp.workerlen; i++ {
 		//新建 workerlen worker(工人) 协程(并发执行)，每个协程可处理一个请求
 		worker := NewWorker()
-		worker.Run(wp.WorkerQueue)
+		worker.Run(wp.ctx, wp.WorkerQueue)
 	}
 	// 循环获取可用的worker,往worker中写job
 	// 这是一个单独的协程只负责保证不断获取可用的worker
@@ -84,11 +131,84 @@ func (wp *WorkerPool) Run() {
 			select {
 			//读取任务
 			case job := <-wp.JobQueue:
+				// 等待并发控制的许可，线程池停止超时后丢弃
+				if wp.limiter != nil && !wp.limiter.Acquire(wp.ctx) {
+					atomic.AddInt64(&wp.queued, -1)
+					metrics.PoolQueued.WithLabelValues().Dec()
+					wp.pending.Done()
+					continue
+				}
 				//尝试获取一个可用的worker作业通道
 				//这将阻塞，直到一个worker空闲
 				worker := <-wp.WorkerQueue
-				worker <- job
+				atomic.AddInt64(&wp.queued, -1)
+				metrics.PoolQueued.WithLabelValues().Dec()
+				worker <- countedJob{job: job, wp: wp}
 			}
 		}
 	}()
 }
+
+// 提交任务，没有空闲的worker时阻塞
+// 线程池已停止时不再接收任务，返回false
+func (wp *WorkerPool) Submit(job Job) bool {
+	wp.mu.Lock()
+	if wp.closed {
+		wp.mu.Unlock()
+		return false
+	}
+	wp.pending.Add(1)
+	wp.mu.Unlock()
+	atomic.AddInt64(&wp.queued, 1)
+	metrics.PoolQueued.WithLabelValues().Inc()
+	wp.JobQueue <- job
+	return true
+}
+
+// 停止接收新任务，等待已提交的任务执行完成
+// 超过 timeout 仍有任务未完成时取消正在执行的任务并返回false
+func (wp *WorkerPool) Stop(timeout time.Duration) bool {
+	wp.mu.Lock()
+	wp.closed = true
+	wp.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		wp.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		wp.cancel()
+		return false
+	}
+}
+
+// 设置并发控制，需要在 Run 之前调用
+func (wp *WorkerPool) SetLimiter(limiter *AIMDLimiter) {
+	wp.limiter = limiter
+}
+
+// 当前并发上限，未设置并发控制时为worker数量
+func (wp *WorkerPool) Limit() int {
+	if wp.limiter == nil {
+		return wp.workerlen
+	}
+	return wp.limiter.Limit()
+}
+
+// worker(工人)的数量
+func (wp *WorkerPool) Workers() int {
+	return wp.workerlen
+}
+
+// 已提交但还未开始执行的任务数
+func (wp *WorkerPool) Queued() int {
+	return int(atomic.LoadInt64(&wp.queued))
+}
+
+// 正在执行任务的worker数
+func (wp *WorkerPool) Busy() int {
+	return int(atomic.LoadInt64(&wp.busy))
+}
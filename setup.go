@@ -3,7 +3,9 @@ package main
 import (
 	"WowjoyProject/ObjectCloudService_Upload_Dicom/global"
 	"WowjoyProject/ObjectCloudService_Upload_Dicom/internal/model"
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/bandwidth"
 	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/logger"
+	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/object"
 	"WowjoyProject/ObjectCloudService_Upload_Dicom/pkg/setting"
 	"log"
 	"time"
@@ -38,11 +40,47 @@ func setupSetting() error {
 		return err
 	}
 
+	err = setting.ReadSection("SourceHost", &global.SourceHostSetting)
+	if err != nil {
+		return err
+	}
+
+	err = setupBandwidth(setting)
+	if err != nil {
+		return err
+	}
+	// 带宽限制修改配置文件后立即生效，配置有误时保留原来的限制
+	setting.WatchSettingChange(func() {
+		if err := setupBandwidth(setting); err != nil {
+			global.Logger.Error("带宽限制配置有误，继续使用原来的配置: ", err)
+			return
+		}
+		global.Logger.Info("带宽限制配置已更新，当前速率(字节/秒): ", bandwidth.Default.Rate())
+	})
+
 	global.ServerSetting.ReadTimeout *= time.Second
 	global.ServerSetting.WriteTimeout *= time.Second
 	return nil
 }
 
+func setupBandwidth(s *setting.Setting) error {
+	bandwidthSetting := &setting.BandwidthSettingS{}
+	err := s.ReadSection("Bandwidth", bandwidthSetting)
+	if err != nil {
+		return err
+	}
+	rules := make([]bandwidth.Rule, 0, len(bandwidthSetting.Schedule))
+	for _, r := range bandwidthSetting.Schedule {
+		rules = append(rules, bandwidth.Rule{Start: r.Start, End: r.End, Rate: r.Rate})
+	}
+	err = bandwidth.Default.SetSchedule(bandwidthSetting.Default, rules)
+	if err != nil {
+		return err
+	}
+	global.BandwidthSetting = bandwidthSetting
+	return nil
+}
+
 func setupLogger() error {
 	global.Logger = logger.NewLogger(&lumberjack.Logger{
 		Filename:  global.GeneralSetting.LogSavePath + "/" + global.GeneralSetting.LogFileName + global.GeneralSetting.LogFileExt,
@@ -88,4 +126,8 @@ func readSetup() {
 	if err != nil {
 		log.Fatalf("init.setupWriteDBEngine err: %v", err)
 	}
+	err = object.SetupBackend()
+	if err != nil {
+		log.Fatalf("init.setupBackend err: %v", err)
+	}
 }
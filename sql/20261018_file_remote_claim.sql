@@ -0,0 +1,8 @@
+-- 多实例认领上传数据：认领者标识和租约到期时间，租约过期后其他实例可以重新认领
+alter table file_remote add column dcm_claim_owner varchar(64) null comment 'DCM文件上传认领者';
+alter table file_remote add column dcm_claim_expire datetime null comment 'DCM文件上传认领租约到期时间';
+alter table file_remote add column img_claim_owner varchar(64) null comment 'JPG文件上传认领者';
+alter table file_remote add column img_claim_expire datetime null comment 'JPG文件上传认领租约到期时间';
+-- 启动/停止服务时按认领者释放认领
+alter table file_remote add index idx_file_remote_dcm_claim_owner (dcm_claim_owner);
+alter table file_remote add index idx_file_remote_img_claim_owner (img_claim_owner);
@@ -0,0 +1,13 @@
+-- 上传失败记录：每个 instance_key + 文件类型 + 存储类型一条，记录失败次数和最后一次失败的原因，上传成功后删除
+create table if not exists file_remote_failure (
+  instance_key bigint not null comment 'instance_key',
+  file_type tinyint not null comment '文件类型：0 DCM，1 JPG',
+  store_type tinyint not null comment '存储类型：0 公有云，1 私有云',
+  attempt_count int not null default 0 comment '失败次数',
+  last_error_code varchar(64) null comment '最后一次失败的错误码',
+  last_error_msg varchar(1024) null comment '最后一次失败的错误信息',
+  last_attempt_time datetime null comment '最后一次失败时间',
+  backend varchar(32) null comment '存储后端',
+  primary key (instance_key, file_type, store_type),
+  key idx_file_remote_failure_time (last_attempt_time)
+) engine=InnoDB default charset=utf8 comment '上传失败记录';
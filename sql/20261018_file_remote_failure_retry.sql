@@ -0,0 +1,2 @@
+-- 失败数据自动重试：记录定时重试次数，超过 RetrySweepMax 后不再重试（状态8，永久失败）
+alter table file_remote_failure add column retry_count int not null default 0 comment '定时重试次数';
@@ -0,0 +1,7 @@
+-- 分段上传对象的组合校验和，上传成功时由上传服务写入
+-- dcm/img_file_sha256 只保存整个文件的SHA-256（分段并发上传无法按顺序计算时为null），
+-- 分段上传的对象另外保存组合校验和：各分段SHA-256拼接后的SHA-256（十六进制）加 -分段数，以及计算时使用的分段大小（字节）
+alter table file_remote add column dcm_file_part_sha256 varchar(80) null comment 'DCM文件分段上传组合校验和（SHA-256 of part SHA-256s）';
+alter table file_remote add column dcm_file_part_size bigint null comment 'DCM文件分段上传分段大小（字节）';
+alter table file_remote add column img_file_part_sha256 varchar(80) null comment 'JPG文件分段上传组合校验和（SHA-256 of part SHA-256s）';
+alter table file_remote add column img_file_part_size bigint null comment 'JPG文件分段上传分段大小（字节）';
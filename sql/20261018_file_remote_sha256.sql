@@ -0,0 +1,3 @@
+-- 上传内容校验和（SHA-256，十六进制），上传成功时由上传服务写入
+alter table file_remote add column dcm_file_sha256 varchar(64) null comment 'DCM文件上传内容SHA-256';
+alter table file_remote add column img_file_sha256 varchar(64) null comment 'JPG文件上传内容SHA-256';